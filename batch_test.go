@@ -0,0 +1,91 @@
+package trace_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Soreing/trace"
+	"github.com/Soreing/trace/tracetest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestTimerOnlyBatching(t *testing.T) {
+	clock := tracetest.NewManualClock(time.Now())
+	exp := trace.NewInMemoryExporter()
+	trc, err := trace.NewTraceCore(
+		[]sdktrace.SpanExporter{exp},
+		trace.WithCryptoRandom(),
+		trace.WithClock(clock),
+		trace.UseBatching(time.Second, 0),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trc.Close()
+
+	for i := 0; i < 1000; i++ {
+		_, b := trc.StartSpan(context.Background(), "span")
+		if err := b.End(true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(exp.Spans()); n != 0 {
+		t.Fatalf("exported %d spans before the batch time", n)
+	}
+
+	clock.Advance(time.Second)
+	deadline := time.Now().Add(time.Second)
+	for len(exp.Spans()) < 1000 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := len(exp.Spans()); n != 1000 {
+		t.Fatalf("exported %d spans, want 1000", n)
+	}
+	if n := trc.Stats().Batches; n != 1 {
+		t.Errorf("exported %d batches, want 1", n)
+	}
+}
+
+func TestHTTPMiddlewareUsesClock(t *testing.T) {
+	clock := tracetest.NewManualClock(time.Now())
+	exp := trace.NewInMemoryExporter()
+	trc, err := trace.NewTraceCore(
+		[]sdktrace.SpanExporter{exp},
+		trace.WithCryptoRandom(),
+		trace.WithClock(clock),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := trc.HTTPMiddleware(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			clock.Advance(3 * time.Second)
+		},
+	))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exp.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("exported %d spans, want 1", len(spans))
+	}
+	var dur float64
+	for _, kv := range spans[0].Attributes() {
+		if kv.Key == trace.ServerDurationKey {
+			dur = kv.Value.AsFloat64()
+		}
+	}
+	if dur != 3 {
+		t.Errorf("got server duration %v, want 3", dur)
+	}
+	if d := spans[0].EndTime().Sub(spans[0].StartTime()); d != 3*time.Second {
+		t.Errorf("got span duration %v, want 3s", d)
+	}
+}
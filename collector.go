@@ -0,0 +1,670 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// spanCollector receives spans and exports them to each exporter, either one
+// by one or in batches.
+type spanCollector struct {
+	exporters []sdktrace.SpanExporter
+	health    []exporterHealth
+	locks     []sync.Mutex
+	parallel  bool
+	onError   func(error)
+	onFlush   func(int)
+	clock     Clock
+	jitter    time.Duration
+
+	batched bool
+	batchCh chan sdktrace.ReadOnlySpan
+	batchWg *sync.WaitGroup
+	drainCh chan chan []sdktrace.ReadOnlySpan
+	flushCh chan flushRequest
+
+	queued   bool
+	blocking bool
+	maxWait  time.Duration
+	maxBytes int
+	idleTime time.Duration
+
+	jobs     chan exportJob
+	workerWg *sync.WaitGroup
+
+	lanes  []chan laneJob
+	laneWg *sync.WaitGroup
+
+	mtx      *sync.RWMutex
+	closed   bool
+	shutdown bool
+	drained  chan struct{}
+	closeCtx atomic.Value
+
+	enqueued   atomic.Uint64
+	exported   atomic.Uint64
+	dropped    atomic.Uint64
+	batches    atomic.Uint64
+	duplicates atomic.Uint64
+}
+
+// Stats are the counters of the spans handled by the tracer.
+type Stats struct {
+	// Enqueued is the number of spans accepted for export.
+	Enqueued uint64 `json:"enqueued"`
+	// Exported is the number of spans sent to the exporters.
+	Exported uint64 `json:"exported"`
+	// Dropped is the number of spans that were not accepted.
+	Dropped uint64 `json:"dropped"`
+	// Batches is the number of batches sent to the exporters.
+	Batches uint64 `json:"batches"`
+	// Duplicates is the number of spans dropped by the duplicate filter.
+	Duplicates uint64 `json:"duplicates"`
+}
+
+// ErrClosed is returned when spans are dispatched after the tracer is closed.
+var ErrClosed = errors.New("collector closed")
+
+// ErrQueueFull is returned when a span is dropped because the queue is full.
+var ErrQueueFull = errors.New("queue full")
+
+// ErrShutdown wraps the errors returned by the exporters when they are shut
+// down while the collector is closed.
+var ErrShutdown = errors.New("exporter shutdown failed")
+
+// DefaultBackpressureTimeout is the longest time a span waits for space in a
+// full queue with backpressure when no timeout is specified.
+const DefaultBackpressureTimeout = time.Second
+
+// exportJob is a batch of spans handed over to the workers. If wg is set, it
+// is notified when the batch is exported.
+type exportJob struct {
+	ctx   context.Context
+	spans []sdktrace.ReadOnlySpan
+	wg    *sync.WaitGroup
+}
+
+// exporterQueueSize is the number of batches that can wait for an exporter in
+// parallel mode before further batches are dropped for that exporter.
+const exporterQueueSize = 256
+
+// laneJob is a batch of spans waiting to be exported by the goroutine of an
+// exporter in parallel mode. A job without spans only notifies the wait
+// group, so that waiting for it waits for the jobs queued before it. The done
+// function is called after the spans are exported.
+type laneJob struct {
+	ctx   context.Context
+	spans []sdktrace.ReadOnlySpan
+	wg    *sync.WaitGroup
+	done  func()
+}
+
+// flushRequest asks the batcher to export every span it holds with the
+// context. The wait group is notified when the spans are exported.
+type flushRequest struct {
+	ctx context.Context
+	wg  *sync.WaitGroup
+}
+
+// newSpanCollector creates a span collector. Spans are batched if the batch
+// time is positive and the batch limit is not one. A batch limit of zero or
+// less means that batches are only exported by the timer. Batches are
+// exported by the batcher, or by a pool of workers if the export concurrency
+// is greater than one.
+func newSpanCollector(
+	exporters []sdktrace.SpanExporter,
+	cfg *Configuration,
+) *spanCollector {
+	sc := &spanCollector{
+		exporters: exporters,
+		health:    make([]exporterHealth, len(exporters)),
+		locks:     make([]sync.Mutex, len(exporters)),
+		parallel:  cfg.parallel && len(exporters) > 1,
+		onError:   cfg.onError,
+		onFlush:   cfg.onFlush,
+		clock:     cfg.clock,
+		jitter:    cfg.jitter,
+		batched:   cfg.batchTime > 0 && cfg.batchCount != 1,
+		batchWg:   &sync.WaitGroup{},
+		workerWg:  &sync.WaitGroup{},
+		laneWg:    &sync.WaitGroup{},
+		mtx:       &sync.RWMutex{},
+		closed:    false,
+	}
+
+	if sc.parallel {
+		sc.lanes = make([]chan laneJob, len(exporters))
+		sc.laneWg.Add(len(exporters))
+		for i := range sc.lanes {
+			sc.lanes[i] = make(chan laneJob, exporterQueueSize)
+			go sc.lane(i)
+		}
+	}
+
+	if sc.batched {
+		if cfg.workers > 1 {
+			sc.jobs = make(chan exportJob)
+			sc.workerWg.Add(cfg.workers)
+			for i := 0; i < cfg.workers; i++ {
+				go sc.worker()
+			}
+		}
+
+		sc.batchWg.Add(1)
+		sc.maxBytes = cfg.maxBatchBytes
+		sc.idleTime = cfg.idleTime
+		sc.queued = cfg.queueSize > 0
+		sc.blocking = cfg.backpressure
+		sc.maxWait = cfg.backpressureWait
+		if sc.maxWait <= 0 {
+			sc.maxWait = DefaultBackpressureTimeout
+		}
+		sc.batchCh = make(chan sdktrace.ReadOnlySpan, cfg.queueSize)
+		sc.drainCh = make(chan chan []sdktrace.ReadOnlySpan)
+		sc.flushCh = make(chan flushRequest)
+		// The batch timer is started before the batcher so that the
+		// batch time is measured from the creation of the collector.
+		timer := sc.clock.NewTimer(sc.interval(cfg.batchTime))
+		go sc.batcher(timer, cfg.batchTime, cfg.batchCount)
+	}
+
+	return sc
+}
+
+// worker exports the batches handed over by the batcher.
+func (sc *spanCollector) worker() {
+	defer sc.workerWg.Done()
+	for job := range sc.jobs {
+		sc.export(job.ctx, job.spans, job.wg)
+		if job.wg != nil {
+			job.wg.Done()
+		}
+	}
+}
+
+// lane exports the batches queued for the i-th exporter in parallel mode.
+func (sc *spanCollector) lane(i int) {
+	defer sc.laneWg.Done()
+	for job := range sc.lanes[i] {
+		if job.spans != nil {
+			sc.exportTo(job.ctx, i, job.spans)
+		}
+		if job.done != nil {
+			job.done()
+		}
+		if job.wg != nil {
+			job.wg.Done()
+		}
+	}
+}
+
+// batcher collects spans into a buffer and exports them when the buffer is
+// full, when the batch time elapses or when the collector is closed. With a
+// byte limit, the buffer is also exported before the estimated size of its
+// spans would exceed the limit. With an idle time, the buffer is exported
+// when no spans are received for the idle time.
+func (sc *spanCollector) batcher(timer Timer, dur time.Duration, limit int) {
+	defer sc.batchWg.Done()
+	if sc.jobs != nil {
+		defer close(sc.jobs)
+	}
+
+	if limit < 0 {
+		limit = 0
+	}
+	buffer := make([]sdktrace.ReadOnlySpan, 0, limit)
+	count, size := 0, 0
+
+	var idle Timer
+	var idleC <-chan time.Time
+	if sc.idleTime > 0 {
+		idle = sc.clock.NewTimer(sc.idleTime)
+		idle.Stop()
+		idleC = idle.C()
+		defer idle.Stop()
+	}
+
+	// emit exports the buffered spans and restarts the batch timer.
+	emit := func(ctx context.Context, wg *sync.WaitGroup) {
+		if count > 0 {
+			if wg != nil {
+				wg.Add(1)
+			}
+			sc.flush(ctx, buffer[:count], wg)
+			count, size = 0, 0
+		}
+		resetTimer(timer, sc.interval(dur))
+	}
+
+	// add buffers a span and exports the buffer when it is full.
+	add := func(
+		ctx context.Context,
+		sp sdktrace.ReadOnlySpan,
+		wg *sync.WaitGroup,
+	) {
+		n := 0
+		if sc.maxBytes > 0 {
+			n = spanSize(sp)
+			if count > 0 && size+n > sc.maxBytes {
+				emit(ctx, wg)
+			}
+		}
+		buffer = append(buffer[:count], sp)
+		count, size = count+1, size+n
+		if count == limit {
+			emit(ctx, wg)
+		}
+	}
+
+	ctx := context.Background()
+	var sp sdktrace.ReadOnlySpan
+	for active := true; active; {
+		select {
+		case sp, active = <-sc.batchCh:
+			if active {
+				add(ctx, sp, nil)
+				if idle != nil {
+					resetTimer(idle, sc.idleTime)
+				}
+			} else {
+				emit(sc.closeCtx.Load().(context.Context), nil)
+			}
+		case <-timer.C():
+			emit(ctx, nil)
+		case <-idleC:
+			if count > 0 {
+				emit(ctx, nil)
+			}
+		case req := <-sc.flushCh:
+			for n := len(sc.batchCh); n > 0; n-- {
+				add(req.ctx, <-sc.batchCh, req.wg)
+			}
+			emit(req.ctx, req.wg)
+			req.wg.Done()
+		case reply := <-sc.drainCh:
+			spans := append([]sdktrace.ReadOnlySpan{}, buffer[:count]...)
+			for n := len(sc.batchCh); n > 0; n-- {
+				spans = append(spans, <-sc.batchCh)
+			}
+			reply <- spans
+			count, size = 0, 0
+		}
+	}
+
+	timer.Stop()
+}
+
+// interval returns the batch time with a random jitter of up to the maximum
+// jitter added, so that the batches of many processes are spread out.
+func (sc *spanCollector) interval(dur time.Duration) time.Duration {
+	if sc.jitter <= 0 {
+		return dur
+	}
+	return dur + time.Duration(rand.Int63n(int64(sc.jitter)))
+}
+
+// spanSize estimates the size of a span when it is exported from the length
+// of its name and attributes, plus a fixed size for the ids and timestamps.
+func spanSize(sp sdktrace.ReadOnlySpan) int {
+	size := 64 + len(sp.Name())
+	for _, kv := range sp.Attributes() {
+		size += len(kv.Key) + len(kv.Value.Emit())
+	}
+	return size
+}
+
+// flush exports a batch of spans, or hands a copy of it over to the workers
+// when there are any. If wg is set, it is notified when the batch is exported.
+func (sc *spanCollector) flush(
+	ctx context.Context,
+	spans []sdktrace.ReadOnlySpan,
+	wg *sync.WaitGroup,
+) {
+	if sc.jobs != nil {
+		cpy := append([]sdktrace.ReadOnlySpan{}, spans...)
+		sc.jobs <- exportJob{ctx: ctx, spans: cpy, wg: wg}
+		return
+	}
+
+	sc.export(ctx, spans, wg)
+	if wg != nil {
+		wg.Done()
+	}
+}
+
+// export sends the spans to every exporter. An error or a slow exporter does
+// not prevent the other exporters from receiving the spans. In parallel mode
+// the spans are queued for the goroutine of each exporter and export returns
+// without waiting for them, so a slow exporter only delays itself. If wg is
+// set, it is also notified when each exporter has exported the spans. If the
+// queue of an exporter is full, the spans are dropped for that exporter.
+func (sc *spanCollector) export(
+	ctx context.Context,
+	spans []sdktrace.ReadOnlySpan,
+	wg *sync.WaitGroup,
+) {
+	sc.exported.Add(uint64(len(spans)))
+	sc.batches.Add(1)
+	if !sc.parallel {
+		for i := range sc.exporters {
+			sc.exportTo(ctx, i, spans)
+		}
+		if sc.onFlush != nil {
+			sc.onFlush(len(spans))
+		}
+		return
+	}
+
+	cpy := append([]sdktrace.ReadOnlySpan{}, spans...)
+	pending := &atomic.Int32{}
+	pending.Store(int32(len(sc.lanes)))
+	done := func() {
+		if pending.Add(-1) == 0 && sc.onFlush != nil {
+			sc.onFlush(len(cpy))
+		}
+	}
+
+	for i, lane := range sc.lanes {
+		if wg != nil {
+			wg.Add(1)
+		}
+		select {
+		case lane <- laneJob{ctx: ctx, spans: cpy, wg: wg, done: done}:
+		default:
+			if wg != nil {
+				wg.Done()
+			}
+			done()
+			sc.health[i].record(ErrQueueFull)
+			sc.onError(fmt.Errorf("export to exporter %d: %w", i, ErrQueueFull))
+		}
+	}
+}
+
+// exportTo sends the spans to the i-th exporter and records the outcome. A
+// panic in the exporter is recovered and reported as an error. Calls to the
+// same exporter are serialized, since exporters are not required to accept
+// concurrent calls to ExportSpans.
+func (sc *spanCollector) exportTo(
+	ctx context.Context,
+	i int,
+	spans []sdktrace.ReadOnlySpan,
+) {
+	sc.locks[i].Lock()
+	err := safeExport(ctx, sc.exporters[i], spans)
+	sc.locks[i].Unlock()
+	sc.health[i].record(err)
+	if err != nil {
+		sc.onError(fmt.Errorf("export to exporter %d: %w", i, err))
+	}
+}
+
+// safeExport sends the spans to the exporter and converts a panic in the
+// exporter into an error.
+func safeExport(
+	ctx context.Context,
+	e sdktrace.SpanExporter,
+	spans []sdktrace.ReadOnlySpan,
+) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("exporter panicked: %v", r)
+		}
+	}()
+	return e.ExportSpans(ctx, spans)
+}
+
+// Status returns the status of each exporter.
+func (sc *spanCollector) Status() []ExporterStatus {
+	stats := make([]ExporterStatus, len(sc.exporters))
+	for i, e := range sc.exporters {
+		stats[i] = sc.health[i].status(e)
+	}
+	return stats
+}
+
+// Feed submits a span to the collector. Without batching, the span is
+// exported directly on the calling goroutine, so the common configuration of
+// a single unbatched exporter needs no separate fast path.
+func (sc *spanCollector) Feed(sp sdktrace.ReadOnlySpan) error {
+	sc.mtx.RLock()
+	defer sc.mtx.RUnlock()
+	if sc.closed {
+		sc.dropped.Add(1)
+		return ErrClosed
+	}
+
+	if sc.batched {
+		if err := sc.enqueue(sp); err != nil {
+			return err
+		}
+		sc.enqueued.Add(1)
+		return nil
+	}
+	sc.enqueued.Add(1)
+	sc.export(context.Background(), []sdktrace.ReadOnlySpan{sp}, nil)
+	return nil
+}
+
+// enqueue hands the span over to the batcher. Without a queue, it waits until
+// the batcher receives the span. With a queue, the span is dropped if the
+// queue is full, unless backpressure is enabled, in which case it waits for
+// space in the queue for a limited time before dropping the span.
+func (sc *spanCollector) enqueue(sp sdktrace.ReadOnlySpan) error {
+	if !sc.queued {
+		sc.batchCh <- sp
+		return nil
+	}
+
+	select {
+	case sc.batchCh <- sp:
+		return nil
+	default:
+	}
+
+	if sc.blocking {
+		timer := sc.clock.NewTimer(sc.maxWait)
+		defer timer.Stop()
+		select {
+		case sc.batchCh <- sp:
+			return nil
+		case <-timer.C():
+		}
+	}
+
+	sc.dropped.Add(1)
+	return ErrQueueFull
+}
+
+// Drain removes the spans waiting in the batch buffer and returns them
+// without exporting them.
+func (sc *spanCollector) Drain() []sdktrace.ReadOnlySpan {
+	sc.mtx.RLock()
+	defer sc.mtx.RUnlock()
+	if sc.closed || !sc.batched {
+		return nil
+	}
+
+	reply := make(chan []sdktrace.ReadOnlySpan, 1)
+	sc.drainCh <- reply
+	return <-reply
+}
+
+// Flush exports the spans waiting to be batched with the context, and waits
+// until they are exported or the context is done. In parallel mode it also
+// waits for the batches queued for the exporters.
+func (sc *spanCollector) Flush(ctx context.Context) error {
+	sc.mtx.RLock()
+	defer sc.mtx.RUnlock()
+	if sc.closed {
+		return ErrClosed
+	}
+
+	if sc.batched {
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		select {
+		case sc.flushCh <- flushRequest{ctx: ctx, wg: wg}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err := waitContext(ctx, wg.Wait); err != nil {
+			return err
+		}
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, lane := range sc.lanes {
+		wg.Add(1)
+		select {
+		case lane <- laneJob{wg: wg}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return waitContext(ctx, wg.Wait)
+}
+
+// Dropped returns the number of spans that were not accepted.
+func (sc *spanCollector) Dropped() uint64 {
+	return sc.dropped.Load()
+}
+
+// QueueCapacity returns the number of spans in the queue and its size.
+func (sc *spanCollector) QueueCapacity() (used, total int) {
+	if !sc.batched {
+		return 0, 0
+	}
+	return len(sc.batchCh), cap(sc.batchCh)
+}
+
+// Stats returns the counters of the collector.
+func (sc *spanCollector) Stats() Stats {
+	return Stats{
+		Enqueued: sc.enqueued.Load(),
+		Exported: sc.exported.Load(),
+		Dropped:  sc.dropped.Load(),
+		Batches:  sc.batches.Load(),
+
+		Duplicates: sc.duplicates.Load(),
+	}
+}
+
+// Close exports the remaining spans and shuts down the exporters with the
+// context. Feed holds the read lock while it enqueues a span, so every span
+// that was accepted before Close took the lock is in the batch channel, and
+// the batcher exports all of them before it exits. If the context is done
+// before the spans are exported, the exporters are not shut down and the
+// error of the context is returned. Calling Close again waits for the export
+// to finish and shuts down the exporters. The final batch keeps the context of
+// the first Close, so it is not exported again with the context of a retry.
+// Once the exporters are shut down, calling Close has no effect.
+func (sc *spanCollector) Close(ctx context.Context) error {
+	sc.mtx.Lock()
+	defer sc.mtx.Unlock()
+	if sc.shutdown {
+		return nil
+	}
+	if !sc.closed {
+		sc.closed = true
+		if sc.batched {
+			sc.closeCtx.Store(ctx)
+			close(sc.batchCh)
+		}
+		sc.drained = make(chan struct{})
+		go func() {
+			sc.batchWg.Wait()
+			sc.workerWg.Wait()
+			for _, lane := range sc.lanes {
+				close(lane)
+			}
+			sc.laneWg.Wait()
+			close(sc.drained)
+		}()
+	}
+
+	select {
+	case <-sc.drained:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	sc.shutdown = true
+	var errs []error
+	for i, e := range sc.exporters {
+		if err := e.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown exporter %d: %w", i, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrShutdown, errors.Join(errs...))
+	}
+	return nil
+}
+
+// waitContext calls the wait function and returns when it returns or when
+// the context is done, whichever happens first.
+func waitContext(ctx context.Context, wait func()) error {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// resetTimer stops the timer, discards a pending tick and resets it.
+func resetTimer(timer Timer, dur time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C():
+		default:
+		}
+	}
+	timer.Reset(dur)
+}
+
+// ExporterStatus describes the outcome of the last export of an exporter.
+type ExporterStatus struct {
+	Exporter   sdktrace.SpanExporter
+	Healthy    bool
+	LastError  error
+	LastExport time.Time
+}
+
+// exporterHealth tracks the outcome of the last export of an exporter.
+type exporterHealth struct {
+	mtx  sync.Mutex
+	err  error
+	last time.Time
+}
+
+func (h *exporterHealth) record(err error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.err, h.last = err, time.Now()
+}
+
+func (h *exporterHealth) status(e sdktrace.SpanExporter) ExporterStatus {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return ExporterStatus{
+		Exporter:   e,
+		Healthy:    h.err == nil,
+		LastError:  h.err,
+		LastExport: h.last,
+	}
+}
@@ -0,0 +1,275 @@
+package trace
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// overlapExporter records whether ExportSpans was ever called concurrently.
+type overlapExporter struct {
+	active  atomic.Int32
+	overlap atomic.Bool
+	spans   atomic.Int64
+	delay   time.Duration
+}
+
+func (e *overlapExporter) ExportSpans(
+	ctx context.Context,
+	spans []sdktrace.ReadOnlySpan,
+) error {
+	if e.active.Add(1) > 1 {
+		e.overlap.Store(true)
+	}
+	time.Sleep(e.delay)
+	e.spans.Add(int64(len(spans)))
+	e.active.Add(-1)
+	return nil
+}
+
+func (e *overlapExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// endSpan starts and successfully ends a root span.
+func endSpan(t *testing.T, trc *TraceCore, name string) {
+	t.Helper()
+	_, b := trc.StartSpan(context.Background(), name)
+	if err := b.End(true); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExportConcurrencySerializesExporter(t *testing.T) {
+	exp := &overlapExporter{delay: time.Millisecond}
+	trc, err := NewTraceCore(
+		[]sdktrace.SpanExporter{exp},
+		WithCryptoRandom(),
+		UseBatching(time.Hour, 2),
+		WithExportConcurrency(4),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				endSpan(t, trc, "span")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if exp.overlap.Load() {
+		t.Error("exporter was called concurrently")
+	}
+	if n := exp.spans.Load(); n != 80 {
+		t.Errorf("exported %d spans, want 80", n)
+	}
+}
+
+func TestParallelExportSlowExporter(t *testing.T) {
+	slow := &overlapExporter{delay: 100 * time.Millisecond}
+	fast := NewInMemoryExporter()
+	trc, err := NewTraceCore(
+		[]sdktrace.SpanExporter{slow, fast},
+		WithCryptoRandom(),
+		UseParallelExport(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		endSpan(t, trc, "span")
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("dispatching took %v, want it not to wait for the exporter", d)
+	}
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for len(fast.Spans()) < 5 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := len(fast.Spans()); n != 5 {
+		t.Errorf("fast exporter has %d spans, want 5", n)
+	}
+
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := slow.spans.Load(); n != 5 {
+		t.Errorf("slow exporter has %d spans, want 5", n)
+	}
+}
+
+// shutdownExporter counts the calls to Shutdown.
+type shutdownExporter struct {
+	overlapExporter
+	shutdowns atomic.Int32
+}
+
+func (e *shutdownExporter) Shutdown(ctx context.Context) error {
+	e.shutdowns.Add(1)
+	return nil
+}
+
+func TestCloseRetryAfterTimeout(t *testing.T) {
+	exp := &shutdownExporter{}
+	exp.delay = 100 * time.Millisecond
+	trc, err := NewTraceCore(
+		[]sdktrace.SpanExporter{exp},
+		WithCryptoRandom(),
+		UseBatching(time.Hour, 0),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	endSpan(t, trc, "span")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := trc.CloseCtx(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if n := exp.shutdowns.Load(); n != 0 {
+		t.Fatalf("exporter shut down %d times before the export finished", n)
+	}
+
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := exp.shutdowns.Load(); n != 1 {
+		t.Errorf("exporter shut down %d times, want 1", n)
+	}
+	if n := exp.spans.Load(); n != 1 {
+		t.Errorf("exported %d spans, want 1", n)
+	}
+}
+
+func TestCloseExportsEveryAcceptedSpan(t *testing.T) {
+	const goroutines, perGoroutine = 16, 500
+
+	exp := NewInMemoryExporter()
+	trc, err := NewTraceCore(
+		[]sdktrace.SpanExporter{exp},
+		WithCryptoRandom(),
+		UseBatching(time.Millisecond, 64),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				endSpan(t, trc, "span")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(exp.Spans()); n != goroutines*perGoroutine {
+		t.Errorf("exported %d spans, want %d", n, goroutines*perGoroutine)
+	}
+}
+
+// panicExporter panics on every export.
+type panicExporter struct{}
+
+func (panicExporter) ExportSpans(
+	ctx context.Context,
+	spans []sdktrace.ReadOnlySpan,
+) error {
+	panic("boom")
+}
+
+func (panicExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func TestPanickingExporter(t *testing.T) {
+	var errs []error
+	exp := NewInMemoryExporter()
+	trc, err := NewTraceCore(
+		[]sdktrace.SpanExporter{panicExporter{}, exp},
+		WithCryptoRandom(),
+		WithErrorHandler(func(err error) { errs = append(errs, err) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endSpan(t, trc, "span")
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(exp.Spans()); n != 1 {
+		t.Errorf("exported %d spans, want 1", n)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("got %d errors, want 1", len(errs))
+	}
+	status := trc.ExporterStatus()
+	if status[0].Healthy || !status[1].Healthy {
+		t.Errorf("got health %v and %v, want false and true",
+			status[0].Healthy, status[1].Healthy)
+	}
+}
+
+func BenchmarkFeed(b *testing.B) {
+	configs := []struct {
+		name string
+		opts []Option
+	}{
+		{"unbatched", nil},
+		{"batched", []Option{UseBatching(time.Second, 512)}},
+	}
+
+	for _, cfg := range configs {
+		b.Run(cfg.name, func(b *testing.B) {
+			opts := append([]Option{WithCryptoRandom()}, cfg.opts...)
+			exps := []sdktrace.SpanExporter{NoopExporter{}}
+			trc, err := NewTraceCore(exps, opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer trc.Close()
+
+			inf, flg := trc.CreateRoot()
+			sp, err := trc.NewSpan("span", inf, flg).build(true, time.Now())
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := trc.collector.Feed(sp); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
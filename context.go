@@ -0,0 +1,53 @@
+package trace
+
+import "context"
+
+// Keys of the trace context in log fields.
+const (
+	LogTraceIdKey  = "trace_id"
+	LogSpanIdKey   = "span_id"
+	LogParentIdKey = "parent_id"
+)
+
+type traceInfoKey struct{}
+
+// contextInfo is the trace info and flags stored in a context.
+type contextInfo struct {
+	inf *TraceInfo
+	flg byte
+}
+
+// ContextWithTraceInfo returns a copy of the context that carries the trace
+// info and trace flags.
+func ContextWithTraceInfo(
+	ctx context.Context,
+	inf *TraceInfo,
+	flg byte,
+) context.Context {
+	return context.WithValue(ctx, traceInfoKey{}, contextInfo{inf, flg})
+}
+
+// TraceInfoFromContext returns the trace info and trace flags stored in the
+// context. If the context has no trace info, it returns nil.
+func TraceInfoFromContext(ctx context.Context) (*TraceInfo, byte) {
+	if ci, ok := ctx.Value(traceInfoKey{}).(contextInfo); ok {
+		return ci.inf, ci.flg
+	}
+	return nil, 0
+}
+
+// LogFields returns the trace id, span id and parent id of the trace info
+// stored in the context as alternating keys and values, which can be passed
+// to structured loggers such as slog.Logger.With. The parent id is omitted
+// for spans without a parent. It returns no fields if the context has none.
+func LogFields(ctx context.Context) []any {
+	inf, _ := TraceInfoFromContext(ctx)
+	if inf == nil {
+		return nil
+	}
+	tid, pid, sid := inf.GetStringIds()
+	if inf.pid == [8]byte{} {
+		return []any{LogTraceIdKey, tid, LogSpanIdKey, sid}
+	}
+	return []any{LogTraceIdKey, tid, LogSpanIdKey, sid, LogParentIdKey, pid}
+}
@@ -4,19 +4,48 @@ import (
 	"context"
 	crand "crypto/rand"
 	"encoding/hex"
+	"errors"
+	"expvar"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Soreing/motel"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
 type TraceCore struct {
-	collector motel.SpanCollector
+	collector *spanCollector
 	exporters []sdktrace.SpanExporter
 	rand      Random
+	randomIds bool
+	strict    bool
+	onError   func(error)
+	resource  *resource.Resource
+	aliases   []attribute.Key
+	observe   func(name string, d time.Duration)
+	sampler   Sampler
+
+	keepErrors bool
+	parentKey  attribute.Key
+	utf8Mode   UTF8Mode
+	defaults   []attribute.KeyValue
+	dedup      *spanDeduper
+	maxHops    int
+	clock      Clock
+	stopReport chan struct{}
+	reportWg   *sync.WaitGroup
+	reportOnce *sync.Once
+	rateKey    string
+	rateField  string
+	prefix     []byte
+	rates      *rateWindow
 }
 
 // NewTraceCore creates a service that manages dispatching spans to exporters
@@ -30,21 +59,149 @@ func NewTraceCore(
 		return nil, fmt.Errorf("failed to configure: %w", err)
 	}
 
-	sc := motel.NewSpanCollector(exporters, cfg.batchTime, cfg.batchCount)
-	return &TraceCore{
+	if len(cfg.middleware) > 0 {
+		wrapped := make([]sdktrace.SpanExporter, len(exporters))
+		for i, exp := range exporters {
+			wrapped[i] = ChainExporter(exp, cfg.middleware...)
+		}
+		exporters = wrapped
+	}
+
+	sc := newSpanCollector(exporters, cfg)
+	var dedup *spanDeduper
+	if cfg.dedupWindow > 0 && cfg.dedupSize > 0 {
+		dedup = newSpanDeduper(cfg.clock, cfg.dedupWindow, cfg.dedupSize)
+	}
+	if cfg.expvarName != "" {
+		if expvar.Get(cfg.expvarName) != nil {
+			cfg.onError(fmt.Errorf("expvar %q already exists", cfg.expvarName))
+		} else {
+			expvar.Publish(cfg.expvarName, expvar.Func(func() any {
+				return sc.Stats()
+			}))
+		}
+	}
+
+	trc := &TraceCore{
 		collector: sc,
 		exporters: exporters,
 		rand:      cfg.rand,
-	}, nil
+		randomIds: cfg.randomIds,
+		strict:    cfg.strict,
+		onError:   cfg.onError,
+		resource:  cfg.resource,
+		aliases:   cfg.aliases,
+		observe:   cfg.observe,
+		sampler:   cfg.sampler,
+
+		keepErrors: cfg.keepErrors,
+		parentKey:  cfg.parentKey,
+		utf8Mode:   cfg.utf8Mode,
+		defaults:   cfg.defaults,
+		dedup:      dedup,
+		maxHops:    cfg.maxHops,
+		clock:      cfg.clock,
+		stopReport: make(chan struct{}),
+		reportWg:   &sync.WaitGroup{},
+		reportOnce: &sync.Once{},
+		rateKey:    cfg.rateKey,
+		rateField:  cfg.rateField,
+		prefix:     cfg.prefix,
+	}
+	if cfg.rateWindow > 0 {
+		trc.rates = newRateWindow(cfg.clock, cfg.rateWindow)
+	}
+	if cfg.dropReport > 0 {
+		trc.reportWg.Add(1)
+		go trc.reportDrops(cfg.dropReport)
+	}
+	return trc, nil
 }
 
-// CreateResource creates an open telemetry resource with a name.
+// CreateResource creates an open telemetry resource with a name and the
+// attributes added by the options. The name takes precedence over attributes
+// of the options with the same key.
 func (trc *TraceCore) CreateResource(
 	ctx context.Context,
 	serviceName string,
+	opts ...ResourceOption,
+) (*resource.Resource, error) {
+	attribs := newResourceConfiguration(opts).attribs
+	attribs = append(attribs, trc.serviceAttributes(serviceName)...)
+	return resource.New(ctx, resource.WithAttributes(attribs...))
+}
+
+// CreateResourceFromMap creates an open telemetry resource with a name and
+// string attributes from a map. The name takes precedence over an attribute
+// with the same key in the map.
+func (trc *TraceCore) CreateResourceFromMap(
+	ctx context.Context,
+	serviceName string,
+	attrs map[string]string,
+) (*resource.Resource, error) {
+	attribs := make([]attribute.KeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		attribs = append(attribs, attribute.String(k, v))
+	}
+	attribs = append(attribs, trc.serviceAttributes(serviceName)...)
+	return resource.New(ctx, resource.WithAttributes(attribs...))
+}
+
+// serviceAttributes creates the service name attribute and its aliases.
+func (trc *TraceCore) serviceAttributes(
+	serviceName string,
+) []attribute.KeyValue {
+	attribs := make([]attribute.KeyValue, 0, len(trc.aliases)+1)
+	attribs = append(attribs, semconv.ServiceNameKey.String(serviceName))
+	for _, key := range trc.aliases {
+		attribs = append(attribs, key.String(serviceName))
+	}
+	return attribs
+}
+
+// DefaultDetectTimeout is the time resource detectors are given to finish
+// when no timeout is specified.
+const DefaultDetectTimeout = 5 * time.Second
+
+// CreateDetectedResource creates an open telemetry resource with a name and
+// the attributes found by the detectors. If the detectors do not finish
+// within the timeout (DefaultDetectTimeout if not positive), the error is
+// sent to the error handler and a resource with only the name is returned.
+func (trc *TraceCore) CreateDetectedResource(
+	ctx context.Context,
+	serviceName string,
+	timeout time.Duration,
+	detectors ...resource.Detector,
 ) (*resource.Resource, error) {
-	attrib := semconv.ServiceNameKey.String(serviceName)
-	return resource.New(ctx, resource.WithAttributes(attrib))
+	if timeout <= 0 {
+		timeout = DefaultDetectTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		res *resource.Resource
+		err error
+	}
+
+	attribs := trc.serviceAttributes(serviceName)
+	done := make(chan result, 1)
+	go func() {
+		res, err := resource.New(
+			ctx,
+			resource.WithAttributes(attribs...),
+			resource.WithDetectors(detectors...),
+		)
+		done <- result{res, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.res, r.err
+	case <-ctx.Done():
+		trc.onError(fmt.Errorf("resource detection: %w", ctx.Err()))
+		return resource.NewSchemaless(attribs...), nil
+	}
 }
 
 // CreateSpanId creates new [8]byte span id.
@@ -53,20 +210,264 @@ func (trc *TraceCore) CreateSpanId() (sid [8]byte) {
 	return
 }
 
-// CreateTraceId creates new [16]byte trace id.
+// CreateTraceId creates new [16]byte trace id. With a trace id prefix, the
+// high bytes of the trace id are the prefix and the rest are random.
 func (trc *TraceCore) CreateTraceId() (tid [16]byte) {
-	trc.rand.Fill(tid[:])
+	n := copy(tid[:], trc.prefix)
+	trc.rand.Fill(tid[n:])
 	return
 }
 
-// DispatchSpan submits a span to be dispatched by the exporters.
-func (trc *TraceCore) DispatchSpan(span motel.Span) {
-	trc.collector.Feed(span)
+// CreateRoot creates a TraceInfo object for the root span of a new trace with
+// a new trace id and span id, and the trace flags of the trace. The trace is
+// sampled unless the sampler of the trace service decides otherwise.
+func (trc *TraceCore) CreateRoot() (*TraceInfo, byte) {
+	inf := NewRootTraceInfo(trc.CreateTraceId(), trc.CreateSpanId())
+	flg := trc.rootFlags()
+	if trc.sampler == nil || trc.sampler.ShouldSample(inf.tid, flg) {
+		flg |= FlagSampled
+	}
+	return inf, flg
 }
 
-// Close closes the trace service and dispatches remaining spans.
-func (trc *TraceCore) Close() {
-	trc.collector.Close()
+// rootFlags returns the trace flags of new traces before sampling. The random
+// trace id flag is only set when ids come from one of the built-in random
+// sources, since a custom Random may not be random at all.
+func (trc *TraceCore) rootFlags() byte {
+	if trc.randomIds {
+		return FlagRandom
+	}
+	return 0
+}
+
+// CreateChild creates a TraceInfo object for a child span of inf with a new
+// span id. With a hop limit, the hop counter in the tracestate is incremented
+// for children of remote spans, and exceeding the limit is reported to the
+// error handler.
+func (trc *TraceCore) CreateChild(inf *TraceInfo) *TraceInfo {
+	child := inf.NewChild(trc.CreateSpanId())
+	if trc.maxHops > 0 && inf.remote {
+		hops := child.Hops() + 1
+		val := strconv.Itoa(hops)
+		child.state = TracestateSet(child.state, HopsTracestateKey, val)
+		if hops > trc.maxHops {
+			tid := hex.EncodeToString(inf.tid[:])
+			trc.onError(fmt.Errorf("trace %s exceeded %d hops", tid, trc.maxHops))
+		}
+	}
+	return child
+}
+
+// OutgoingTraceparent creates a child of the trace info stored in the context
+// for an outgoing request, or a new root if the context has none. It returns
+// the traceparent header to send and the trace info of the child span.
+func (trc *TraceCore) OutgoingTraceparent(
+	ctx context.Context,
+) (string, *TraceInfo) {
+	inf, flg := TraceInfoFromContext(ctx)
+	if inf == nil {
+		inf, flg = trc.CreateRoot()
+	} else {
+		inf = trc.CreateChild(inf)
+	}
+	return inf.Traceparent(flg), inf
+}
+
+// ForwardTraceparent creates the traceparent header of an outgoing request
+// forwarded from an incoming one, which continues the trace of the incoming
+// header with a new span id. It returns the outgoing header and the trace info
+// of the forwarding span.
+func (trc *TraceCore) ForwardTraceparent(
+	incoming string,
+) (string, *TraceInfo, error) {
+	_, tid, pid, flg, err := DecodeTraceparent(incoming)
+	if err != nil {
+		return "", nil, err
+	}
+	child := newRemoteTraceInfo(tid, pid).NewChild(trc.CreateSpanId())
+	return child.Traceparent(flg), child, nil
+}
+
+// ErrDuplicate is returned when a span is dropped by the duplicate filter.
+var ErrDuplicate = errors.New("duplicate span")
+
+// DispatchSpan submits a span to be dispatched by the exporters. With strict
+// validation enabled, invalid spans are rejected with an error. With the
+// duplicate filter enabled, repeated spans are dropped with an error. The
+// default span attributes are added to the span if it does not have them
+// already.
+func (trc *TraceCore) DispatchSpan(span motel.Span) error {
+	if trc.strict {
+		if err := validateSpan(span); err != nil {
+			return err
+		}
+	}
+	if trc.dedup != nil && trc.dedup.isDuplicate(span.SpanContext().SpanID()) {
+		trc.collector.duplicates.Add(1)
+		return ErrDuplicate
+	}
+	if len(trc.defaults) > 0 {
+		addDefaultAttributes(span, trc.defaults)
+	}
+	if trc.observe != nil {
+		trc.observe(span.Name(), span.EndTime().Sub(span.StartTime()))
+	}
+	return trc.collector.Feed(span)
+}
+
+// DispatchReadOnlySpan submits a span created by another open telemetry SDK
+// to be dispatched like DispatchSpan. Everything besides the attributes is
+// taken from the span as it is, including its events, links and status.
+func (trc *TraceCore) DispatchReadOnlySpan(span sdktrace.ReadOnlySpan) error {
+	if s, ok := span.(motel.Span); ok {
+		return trc.DispatchSpan(s)
+	}
+	return trc.DispatchSpan(&readOnlySpan{ReadOnlySpan: span})
+}
+
+// readOnlySpan adapts a read-only span to a motel.Span by keeping the added
+// attributes next to the attributes of the span.
+type readOnlySpan struct {
+	sdktrace.ReadOnlySpan
+	attribs []attribute.KeyValue
+}
+
+// WithAttribute adds an attribute to the span.
+func (s *readOnlySpan) WithAttribute(key attribute.Key, value attribute.Value) {
+	s.attribs = append(s.attribs, attribute.KeyValue{Key: key, Value: value})
+}
+
+// Attributes returns the attributes of the span and the added attributes.
+func (s *readOnlySpan) Attributes() []attribute.KeyValue {
+	if len(s.attribs) == 0 {
+		return s.ReadOnlySpan.Attributes()
+	}
+	orig := s.ReadOnlySpan.Attributes()
+	attribs := make([]attribute.KeyValue, 0, len(orig)+len(s.attribs))
+	return append(append(attribs, orig...), s.attribs...)
+}
+
+// Drain removes the spans waiting to be dispatched in a batch and returns
+// them without exporting them.
+func (trc *TraceCore) Drain() []motel.Span {
+	buffered := trc.collector.Drain()
+	spans := make([]motel.Span, 0, len(buffered))
+	for _, sp := range buffered {
+		if s, ok := sp.(motel.Span); ok {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+// Exporters returns the exporters that spans are dispatched to, wrapped with
+// the exporter middleware, if any.
+func (trc *TraceCore) Exporters() []sdktrace.SpanExporter {
+	return append([]sdktrace.SpanExporter{}, trc.exporters...)
+}
+
+// ExporterStatus returns the outcome of the last export of each exporter.
+// An exporter that has not exported any spans yet is considered healthy.
+func (trc *TraceCore) ExporterStatus() []ExporterStatus {
+	return trc.collector.Status()
+}
+
+// Dropped returns the number of spans that were dispatched but not accepted,
+// such as the spans dispatched after the trace service was closed.
+func (trc *TraceCore) Dropped() uint64 {
+	return trc.collector.Dropped()
+}
+
+// QueueCapacity returns the number of spans waiting in the queue for the
+// batcher and the size of the queue, such as for samplers that lower the
+// sample rate as the queue fills up. Without batching or a queue size, the
+// size is zero.
+func (trc *TraceCore) QueueCapacity() (used, total int) {
+	return trc.collector.QueueCapacity()
+}
+
+// SampleRate returns the ratio of the ended spans that were sampled over the
+// sample rate window, and the number of sampled and total spans. It returns
+// zeros if no window is configured or no spans ended in the window.
+func (trc *TraceCore) SampleRate() (rate float64, sampled, total uint64) {
+	if trc.rates == nil {
+		return 0, 0, 0
+	}
+	sampled, total = trc.rates.counts()
+	if total == 0 {
+		return 0, 0, 0
+	}
+	return float64(sampled) / float64(total), sampled, total
+}
+
+// Flush exports the spans waiting to be dispatched in a batch. The context is
+// passed to the exporters, and Flush returns early with its error if it is
+// done before the spans are exported.
+func (trc *TraceCore) Flush(ctx context.Context) error {
+	return trc.collector.Flush(ctx)
+}
+
+// Stats returns the counters of the spans handled by the trace service.
+func (trc *TraceCore) Stats() Stats {
+	return trc.collector.Stats()
+}
+
+// Close closes the trace service and dispatches remaining spans. Every span
+// that DispatchSpan accepted without an error before Close was called is
+// exported before Close returns, including the spans of a partial batch.
+// Spans that are dispatched after Close are dropped. Errors of shutting down
+// the exporters are joined and returned wrapped in ErrShutdown. Calling Close
+// more than once has no effect.
+func (trc *TraceCore) Close() error {
+	trc.stopReporting()
+	return trc.collector.Close(context.Background())
+}
+
+// CloseCtx closes the trace service like Close. The context is passed to the
+// exporters, and CloseCtx returns early with its error if it is done before
+// the remaining spans are dispatched, in which case the exporters are not
+// shut down yet, and calling Close or CloseCtx again finishes the shutdown.
+// A retried close waits for the spans that are still being exported, but it
+// does not export again the spans that were already handed to the exporters
+// with the done context, so exporters that fail on it lose those spans.
+// Errors of shutting down the exporters wrap ErrShutdown.
+func (trc *TraceCore) CloseCtx(ctx context.Context) error {
+	trc.stopReporting()
+	return trc.collector.Close(ctx)
+}
+
+// addDefaultAttributes adds the default attributes to the span, except for
+// the ones whose key the span already has.
+func addDefaultAttributes(span motel.Span, defaults []attribute.KeyValue) {
+	attribs := span.Attributes()
+	for _, def := range defaults {
+		found := false
+		for _, kv := range attribs {
+			if kv.Key == def.Key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			span.WithAttribute(def.Key, def.Value)
+		}
+	}
+}
+
+// validateSpan checks that the span has a name, a non-zero trace id and a
+// non-zero span id.
+func validateSpan(span motel.Span) error {
+	sc := span.SpanContext()
+	if span.Name() == "" {
+		return fmt.Errorf("invalid span name")
+	}
+	if !sc.HasTraceID() {
+		return ErrInvalidTraceId
+	}
+	if !sc.HasSpanID() {
+		return ErrInvalidSpanId
+	}
+	return nil
 }
 
 // CreateSpanId creates new [8]byte span id using entropy from crypto/rand.
@@ -81,53 +482,186 @@ func CreateTraceId() (tid [16]byte, err error) {
 	return
 }
 
+// Trace flags defined by the w3c trace context specification.
+const (
+	// FlagSampled indicates that the caller may have recorded trace data.
+	FlagSampled byte = 0x01
+	// FlagRandom indicates that the trace id was generated randomly.
+	FlagRandom byte = 0x02
+)
+
+// IsSampled reports whether the sampled bit is set in the trace flags.
+func IsSampled(flg byte) bool {
+	return flg&FlagSampled != 0
+}
+
+// IsRandomTraceID reports whether the random trace id bit is set in the
+// trace flags.
+func IsRandomTraceID(flg byte) bool {
+	return flg&FlagRandom != 0
+}
+
 // EncodeTraceparent creates a w3c traceparent header from the given version,
-// trace id, parent id and flag bytes and byte arrays.
+// trace id, parent id and flag bytes and byte arrays. The inputs are not
+// validated, see EncodeTraceparentChecked.
 func EncodeTraceparent(ver byte, tid [16]byte, pid [8]byte, flg byte) string {
-	header := make([]byte, 55)
+	// The buffer does not escape, so it stays on the stack and the string is
+	// the only allocation. Pooling the buffer saves nothing, since the string
+	// conversion copies it anyway. Use AppendTraceparent to avoid allocating.
+	return string(AppendTraceparent(make([]byte, 0, 55), ver, tid, pid, flg))
+}
+
+// EncodeTraceparentChecked works like EncodeTraceparent, but it returns an
+// error instead of a header that DecodeTraceparent would reject, such as for
+// an all-zero trace id or parent id, or for the invalid version ff.
+func EncodeTraceparentChecked(
+	ver byte,
+	tid [16]byte,
+	pid [8]byte,
+	flg byte,
+) (string, error) {
+	if ver == 0xff {
+		return "", ErrInvalidVersion
+	}
+	if tid == [16]byte{} {
+		return "", ErrInvalidTraceId
+	}
+	if pid == [8]byte{} {
+		return "", ErrInvalidParentId
+	}
+	return EncodeTraceparent(ver, tid, pid, flg), nil
+}
+
+// AppendTraceparent appends a w3c traceparent header created from the given
+// version, trace id, parent id and flag to dst and returns the extended slice.
+func AppendTraceparent(
+	dst []byte,
+	ver byte,
+	tid [16]byte,
+	pid [8]byte,
+	flg byte,
+) []byte {
+	n := len(dst)
+	dst = append(dst, make([]byte, 55)...)
+	header := dst[n:]
 	header[2], header[35], header[52] = '-', '-', '-'
 	hex.Encode(header[:2], []byte{ver})
 	hex.Encode(header[3:35], tid[:])
 	hex.Encode(header[36:52], pid[:])
 	hex.Encode(header[53:], []byte{flg})
-	return string(header)
+	return dst
 }
 
+// Errors returned for invalid traceparent headers and ids. They are
+// preallocated so that rejecting malformed headers does not allocate.
+var (
+	ErrInvalidLength   = errors.New("invalid length")
+	ErrInvalidFormat   = errors.New("invalid format")
+	ErrInvalidVersion  = errors.New("invalid version")
+	ErrInvalidFlag     = errors.New("invalid flag")
+	ErrInvalidTraceId  = errors.New("invalid trace id")
+	ErrInvalidParentId = errors.New("invalid parent id")
+	ErrInvalidSpanId   = errors.New("invalid span id")
+)
+
 // DecodeTraceparent parses and validates a w3c traceparent header and returns
-// the version, trace id, parent id and flag as bytes and byte arrays.
+// the version, trace id, parent id and flag as bytes and byte arrays. Headers
+// of versions after 00 may be longer, in which case only the fields known in
+// version 00 are decoded. The flag is returned as it is in the header, with
+// bits that are not defined by the specification preserved.
 func DecodeTraceparent(
 	header string,
 ) (ver byte, tid [16]byte, pid [8]byte, flg byte, err error) {
+	return decodeTraceparent(header, 0)
+}
+
+// DecodeTraceparentCaseInsensitive works like DecodeTraceparent, but it also
+// accepts upper case hex digits in the trace id and parent id, which is not
+// allowed by the specification but sent by some non-compliant systems.
+func DecodeTraceparentCaseInsensitive(
+	header string,
+) (ver byte, tid [16]byte, pid [8]byte, flg byte, err error) {
+	return decodeTraceparent(header, decodeUpperCase)
+}
+
+// DecodeTraceparentLenient works like DecodeTraceparent, but it accepts an
+// all-zero parent id and returns it as-is, so that the trace id can still be
+// used from systems that send invalid parent ids.
+func DecodeTraceparentLenient(
+	header string,
+) (ver byte, tid [16]byte, pid [8]byte, flg byte, err error) {
+	return decodeTraceparent(header, decodeZeroParent)
+}
+
+// DecodeTraceparentList decodes the first valid traceparent in a header with
+// multiple traceparents joined by commas, which some proxies send even though
+// it is not allowed by the specification. Whitespace around the values is
+// ignored. If none of the values is valid, the error of the first one is
+// returned.
+func DecodeTraceparentList(
+	header string,
+) (ver byte, tid [16]byte, pid [8]byte, flg byte, err error) {
+	var first error
+	for _, value := range strings.Split(header, ",") {
+		ver, tid, pid, flg, err = DecodeTraceparent(strings.TrimSpace(value))
+		if err == nil {
+			return ver, tid, pid, flg, nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return 0, [16]byte{}, [8]byte{}, 0, first
+}
+
+// decodeMode is a set of flags that relax the validation of a traceparent.
+type decodeMode uint8
+
+const (
+	// decodeUpperCase accepts upper case hex digits.
+	decodeUpperCase decodeMode = 1 << iota
+	// decodeZeroParent accepts an all-zero parent id.
+	decodeZeroParent
+)
+
+// decodeTraceparent parses and validates a w3c traceparent header with the
+// validation rules relaxed by the mode.
+func decodeTraceparent(
+	header string,
+	mode decodeMode,
+) (ver byte, tid [16]byte, pid [8]byte, flg byte, err error) {
+	upper := mode&decodeUpperCase != 0
 	var d1, d2, c uint8
 	var val int
 
-	if len(header) != 55 {
-		err = fmt.Errorf("invalid length")
+	if len(header) < 55 {
+		err = ErrInvalidLength
 		return
 	}
 
 	if header[2] != '-' || header[35] != '-' || header[52] != '-' {
-		err = fmt.Errorf("invalid format")
+		err = ErrInvalidFormat
 		return
 	}
 
 	// version
-	switch header[:2] {
-	case "00":
-		ver = 0
-	default:
-		err = fmt.Errorf("invalid version")
+	var ok bool
+	if ver, ok = decodeHexByte(header[0], header[1]); !ok || ver == 0xff {
+		err = ErrInvalidVersion
+		return
+	}
+	if ver == 0 && len(header) != 55 {
+		err = ErrInvalidLength
+		return
+	}
+	if len(header) > 55 && header[55] != '-' {
+		err = ErrInvalidFormat
 		return
 	}
 
 	// flag
-	switch header[53:] {
-	case "00":
-		flg = 0
-	case "01":
-		flg = 1
-	default:
-		err = fmt.Errorf("invalid flag")
+	if flg, ok = decodeHexByte(header[53], header[54]); !ok {
+		err = ErrInvalidFlag
 		return
 	}
 
@@ -137,22 +671,26 @@ func DecodeTraceparent(
 		c = header[3+(i<<1)]
 		if d1 = c - '0'; d1 > 9 {
 			if d1 = c - 'W'; d1 > 15 || d1 < 10 {
-				err = fmt.Errorf("invalid trace id")
-				return
+				if d1 = c - '7'; !upper || d1 > 15 || d1 < 10 {
+					err = ErrInvalidTraceId
+					return
+				}
 			}
 		}
 		c = header[4+(i<<1)]
 		if d2 = c - '0'; d2 > 9 {
 			if d2 = c - 'W'; d2 > 15 || d2 < 10 {
-				err = fmt.Errorf("invalid trace id")
-				return
+				if d2 = c - '7'; !upper || d2 > 15 || d2 < 10 {
+					err = ErrInvalidTraceId
+					return
+				}
 			}
 		}
 		tid[i] = (d1 << 4) + d2
 		val += int(tid[i])
 	}
 	if val == 0 {
-		err = fmt.Errorf("invalid trace id")
+		err = ErrInvalidTraceId
 		return
 	}
 
@@ -162,24 +700,44 @@ func DecodeTraceparent(
 		c = header[36+(i<<1)]
 		if d1 = c - '0'; d1 > 9 {
 			if d1 = c - 'W'; d1 > 15 || d1 < 10 {
-				err = fmt.Errorf("invalid parent id")
-				return
+				if d1 = c - '7'; !upper || d1 > 15 || d1 < 10 {
+					err = ErrInvalidParentId
+					return
+				}
 			}
 		}
 		c = header[37+(i<<1)]
 		if d2 = c - '0'; d2 > 9 {
 			if d2 = c - 'W'; d2 > 15 || d2 < 10 {
-				err = fmt.Errorf("invalid parent id")
-				return
+				if d2 = c - '7'; !upper || d2 > 15 || d2 < 10 {
+					err = ErrInvalidParentId
+					return
+				}
 			}
 		}
 		pid[i] = (d1 << 4) + d2
 		val += int(pid[i])
 	}
-	if val == 0 {
-		err = fmt.Errorf("invalid parent id")
+	if val == 0 && mode&decodeZeroParent == 0 {
+		err = ErrInvalidParentId
 		return
 	}
 
 	return
 }
+
+// decodeHexByte decodes a byte from two lower case hex digits.
+func decodeHexByte(hi, lo byte) (byte, bool) {
+	var d1, d2 byte
+	if d1 = hi - '0'; d1 > 9 {
+		if d1 = hi - 'W'; d1 > 15 || d1 < 10 {
+			return 0, false
+		}
+	}
+	if d2 = lo - '0'; d2 > 9 {
+		if d2 = lo - 'W'; d2 > 15 || d2 < 10 {
+			return 0, false
+		}
+	}
+	return (d1 << 4) + d2, true
+}
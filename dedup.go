@@ -0,0 +1,57 @@
+package trace
+
+import (
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanDeduper remembers the span ids of the latest spans to detect spans that
+// are dispatched more than once within a time window.
+type spanDeduper struct {
+	mtx    *sync.Mutex
+	clock  Clock
+	window time.Duration
+	seen   map[trace.SpanID]time.Time
+	ring   []trace.SpanID
+	next   int
+}
+
+// newSpanDeduper creates a deduper that remembers up to size span ids.
+func newSpanDeduper(
+	clock Clock,
+	window time.Duration,
+	size int,
+) *spanDeduper {
+	return &spanDeduper{
+		mtx:    &sync.Mutex{},
+		clock:  clock,
+		window: window,
+		seen:   make(map[trace.SpanID]time.Time, size),
+		ring:   make([]trace.SpanID, 0, size),
+	}
+}
+
+// isDuplicate records the span id and reports whether it was already seen
+// within the time window.
+func (d *spanDeduper) isDuplicate(sid trace.SpanID) bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	now := d.clock.Now()
+	if last, ok := d.seen[sid]; ok {
+		d.seen[sid] = now
+		return now.Sub(last) < d.window
+	}
+
+	if len(d.ring) < cap(d.ring) {
+		d.ring = append(d.ring, sid)
+	} else {
+		delete(d.seen, d.ring[d.next])
+		d.ring[d.next] = sid
+		d.next = (d.next + 1) % len(d.ring)
+	}
+	d.seen[sid] = now
+	return false
+}
@@ -0,0 +1,62 @@
+package trace
+
+import (
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DropReportSpanName is the name of the diagnostic spans that report dropped
+// spans.
+const DropReportSpanName = "trace.dropped_spans"
+
+// DroppedSpansKey is the attribute key of the number of spans dropped since
+// the last report.
+const DroppedSpansKey = attribute.Key("trace.dropped_spans")
+
+// reportDrops dispatches a diagnostic span every interval in which spans were
+// dropped, until reporting is stopped.
+func (trc *TraceCore) reportDrops(interval time.Duration) {
+	defer trc.reportWg.Done()
+	timer := trc.clock.NewTimer(interval)
+	defer timer.Stop()
+
+	var last uint64
+	for {
+		select {
+		case <-trc.stopReport:
+			return
+		case <-timer.C():
+			if n := trc.collector.Dropped(); n > last {
+				trc.dispatchDropReport(n - last)
+				last = n
+			}
+			timer.Reset(interval)
+		}
+	}
+}
+
+// dispatchDropReport dispatches a diagnostic span with the number of dropped
+// spans in a new trace. The span bypasses sampling.
+func (trc *TraceCore) dispatchDropReport(n uint64) {
+	inf := NewRootTraceInfo(trc.CreateTraceId(), trc.CreateSpanId())
+	b := trc.NewSpan(DropReportSpanName, inf, FlagSampled|trc.rootFlags())
+	b.SetAttributes(DroppedSpansKey.Int64(int64(n)))
+
+	span, err := b.build(true, trc.clock.Now())
+	if err == nil {
+		err = trc.collector.Feed(span)
+	}
+	if err != nil {
+		trc.onError(fmt.Errorf("report dropped spans: %w", err))
+	}
+}
+
+// stopReporting stops reporting dropped spans and waits for the reporter.
+func (trc *TraceCore) stopReporting() {
+	trc.reportOnce.Do(func() {
+		close(trc.stopReport)
+	})
+	trc.reportWg.Wait()
+}
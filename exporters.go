@@ -0,0 +1,228 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ExporterMiddleware wraps an exporter to add behavior to it, such as logging,
+// metrics, retries or transforming the spans. NewOpenTracingExporter is an
+// exporter middleware.
+type ExporterMiddleware func(next sdktrace.SpanExporter) sdktrace.SpanExporter
+
+// ChainExporter wraps the exporter with the middleware. The first middleware
+// is the outermost, so it sees the spans first.
+func ChainExporter(
+	exp sdktrace.SpanExporter,
+	mws ...ExporterMiddleware,
+) sdktrace.SpanExporter {
+	for i := len(mws) - 1; i >= 0; i-- {
+		exp = mws[i](exp)
+	}
+	return exp
+}
+
+// NoopExporter is an exporter that discards every span without an error. It
+// documents that spans are not exported on purpose, such as when tracing is
+// enabled without a sink. The zero value is ready to use.
+type NoopExporter struct{}
+
+// ExportSpans discards the spans.
+func (NoopExporter) ExportSpans(
+	ctx context.Context,
+	spans []sdktrace.ReadOnlySpan,
+) error {
+	return nil
+}
+
+// Shutdown does nothing.
+func (NoopExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// InMemoryExporter is an exporter that stores the exported spans in memory.
+// It is meant to be used in tests to inspect the dispatched spans.
+type InMemoryExporter struct {
+	mtx   *sync.Mutex
+	spans []sdktrace.ReadOnlySpan
+}
+
+// NewInMemoryExporter creates an exporter that stores spans in memory.
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{
+		mtx: &sync.Mutex{},
+	}
+}
+
+// ExportSpans stores the spans.
+func (e *InMemoryExporter) ExportSpans(
+	ctx context.Context,
+	spans []sdktrace.ReadOnlySpan,
+) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// Shutdown does nothing, the stored spans remain available.
+func (e *InMemoryExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Spans returns the stored spans in the order they were exported.
+func (e *InMemoryExporter) Spans() []sdktrace.ReadOnlySpan {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return append([]sdktrace.ReadOnlySpan{}, e.spans...)
+}
+
+// Reset removes the stored spans.
+func (e *InMemoryExporter) Reset() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.spans = nil
+}
+
+var _ sdktrace.SpanExporter = (*InMemoryExporter)(nil)
+
+// OpenTracing tags that differ from the open telemetry semantic conventions.
+const (
+	OpenTracingSpanKindKey = attribute.Key("span.kind")
+	OpenTracingErrorKey    = attribute.Key("error")
+)
+
+// openTracingExporter adds OpenTracing tags to the spans before exporting
+// them with the next exporter.
+type openTracingExporter struct {
+	next sdktrace.SpanExporter
+}
+
+// NewOpenTracingExporter creates an exporter that adds the conventional
+// OpenTracing span.kind and error tags as attributes to the spans, and
+// exports them with the next exporter. This is meant for backends that read
+// OpenTracing style data.
+func NewOpenTracingExporter(next sdktrace.SpanExporter) sdktrace.SpanExporter {
+	return &openTracingExporter{
+		next: next,
+	}
+}
+
+// ExportSpans exports the spans with OpenTracing tags.
+func (e *openTracingExporter) ExportSpans(
+	ctx context.Context,
+	spans []sdktrace.ReadOnlySpan,
+) error {
+	mapped := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, sp := range spans {
+		mapped[i] = &openTracingSpan{ReadOnlySpan: sp}
+	}
+	return e.next.ExportSpans(ctx, mapped)
+}
+
+// Shutdown shuts down the next exporter.
+func (e *openTracingExporter) Shutdown(ctx context.Context) error {
+	return e.next.Shutdown(ctx)
+}
+
+// openTracingSpan is a span with OpenTracing tags added to its attributes.
+type openTracingSpan struct {
+	sdktrace.ReadOnlySpan
+}
+
+// Attributes returns the attributes of the span with the OpenTracing tags.
+func (s *openTracingSpan) Attributes() []attribute.KeyValue {
+	attribs := append([]attribute.KeyValue{}, s.ReadOnlySpan.Attributes()...)
+	switch s.SpanKind() {
+	case trace.SpanKindClient:
+		attribs = append(attribs, OpenTracingSpanKindKey.String("client"))
+	case trace.SpanKindServer:
+		attribs = append(attribs, OpenTracingSpanKindKey.String("server"))
+	case trace.SpanKindProducer:
+		attribs = append(attribs, OpenTracingSpanKindKey.String("producer"))
+	case trace.SpanKindConsumer:
+		attribs = append(attribs, OpenTracingSpanKindKey.String("consumer"))
+	}
+	if s.Status().Code == codes.Error {
+		attribs = append(attribs, OpenTracingErrorKey.Bool(true))
+	}
+	return attribs
+}
+
+// DedupCheckExporter is an exporter that checks that span ids are never
+// repeated and that trace ids are never repeated across root spans. It is
+// meant to be used in tests to detect flaws in id generation. Spans are
+// passed on to the next exporter if one is given.
+type DedupCheckExporter struct {
+	next  sdktrace.SpanExporter
+	mtx   *sync.Mutex
+	spans map[trace.SpanID]struct{}
+	roots map[trace.TraceID]struct{}
+	found []error
+}
+
+// NewDedupCheckExporter creates an exporter that checks ids for collisions
+// and exports the spans with the next exporter, which may be nil.
+func NewDedupCheckExporter(next sdktrace.SpanExporter) *DedupCheckExporter {
+	return &DedupCheckExporter{
+		next:  next,
+		mtx:   &sync.Mutex{},
+		spans: map[trace.SpanID]struct{}{},
+		roots: map[trace.TraceID]struct{}{},
+	}
+}
+
+// ExportSpans records the ids of the spans and exports them with the next
+// exporter. It returns an error if a collision is found.
+func (e *DedupCheckExporter) ExportSpans(
+	ctx context.Context,
+	spans []sdktrace.ReadOnlySpan,
+) error {
+	var err error
+	e.mtx.Lock()
+	for _, sp := range spans {
+		sc := sp.SpanContext()
+		if _, ok := e.spans[sc.SpanID()]; ok {
+			e.found = append(e.found, fmt.Errorf("span id %s repeated", sc.SpanID()))
+			err = e.found[len(e.found)-1]
+		}
+		e.spans[sc.SpanID()] = struct{}{}
+
+		if !sp.Parent().HasSpanID() {
+			if _, ok := e.roots[sc.TraceID()]; ok {
+				e.found = append(e.found, fmt.Errorf("trace id %s repeated", sc.TraceID()))
+				err = e.found[len(e.found)-1]
+			}
+			e.roots[sc.TraceID()] = struct{}{}
+		}
+	}
+	e.mtx.Unlock()
+
+	if e.next != nil {
+		if nerr := e.next.ExportSpans(ctx, spans); nerr != nil {
+			return nerr
+		}
+	}
+	return err
+}
+
+// Shutdown shuts down the next exporter.
+func (e *DedupCheckExporter) Shutdown(ctx context.Context) error {
+	if e.next != nil {
+		return e.next.Shutdown(ctx)
+	}
+	return nil
+}
+
+// Collisions returns an error for each repeated id found so far.
+func (e *DedupCheckExporter) Collisions() []error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return append([]error{}, e.found...)
+}
@@ -0,0 +1,39 @@
+package trace
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestInMemoryExporterBehindMiddleware(t *testing.T) {
+	exp := NewInMemoryExporter()
+	trc, err := NewTraceCore(
+		[]sdktrace.SpanExporter{NewOpenTracingExporter(exp)},
+		WithCryptoRandom(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, b := trc.StartSpan(context.Background(), "span")
+	if err := b.End(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exp.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("stored %d spans, want 1", len(spans))
+	}
+	found := false
+	for _, kv := range spans[0].Attributes() {
+		found = found || kv.Key == OpenTracingErrorKey
+	}
+	if !found {
+		t.Errorf("span has no %s attribute", OpenTracingErrorKey)
+	}
+}
@@ -0,0 +1,182 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// FileExporter is an exporter that appends the spans to a file as JSON lines,
+// one object per span, for offline analysis. With a size limit, the file is
+// rotated by renaming it with the time of the rotation as a suffix before it
+// would grow past the limit.
+type FileExporter struct {
+	mtx     *sync.Mutex
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+}
+
+// NewFileExporter creates an exporter that appends spans to the file at the
+// path, creating it if it does not exist. If maxSize is positive, the file is
+// rotated before it would exceed maxSize bytes.
+func NewFileExporter(path string, maxSize int64) (*FileExporter, error) {
+	e := &FileExporter{
+		mtx:     &sync.Mutex{},
+		path:    path,
+		maxSize: maxSize,
+	}
+	if err := e.open(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// open opens the file for appending and reads its size.
+func (e *FileExporter) open() error {
+	f, err := os.OpenFile(e.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	e.file, e.size = f, info.Size()
+	return nil
+}
+
+// rotate closes the file, renames it and opens a new file at the path. If the
+// file cannot be renamed, the original file is opened again so that the
+// exporter keeps a usable file. If no file can be opened, the exporter is
+// left without a file, as if it was shut down.
+func (e *FileExporter) rotate() error {
+	err := e.file.Close()
+	if err == nil {
+		suffix := time.Now().UTC().Format("20060102T150405.000000000")
+		err = os.Rename(e.path, e.path+"."+suffix)
+	}
+	if oerr := e.open(); oerr != nil {
+		e.file = nil
+		return errors.Join(err, oerr)
+	}
+	return err
+}
+
+// ExportSpans appends the spans to the file.
+func (e *FileExporter) ExportSpans(
+	ctx context.Context,
+	spans []sdktrace.ReadOnlySpan,
+) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if e.file == nil {
+		return fmt.Errorf("exporter shut down")
+	}
+
+	for _, sp := range spans {
+		line, err := json.Marshal(newSpanRecord(sp))
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+
+		n := int64(len(line))
+		if e.maxSize > 0 && e.size > 0 && e.size+n > e.maxSize {
+			if err := e.rotate(); err != nil {
+				return err
+			}
+		}
+		if _, err := e.file.Write(line); err != nil {
+			return err
+		}
+		e.size += n
+	}
+	return nil
+}
+
+// Shutdown closes the file.
+func (e *FileExporter) Shutdown(ctx context.Context) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if e.file == nil {
+		return nil
+	}
+	err := e.file.Close()
+	e.file = nil
+	return err
+}
+
+// spanRecord is the JSON representation of a span in the file.
+type spanRecord struct {
+	Name       string         `json:"name"`
+	TraceId    string         `json:"trace_id"`
+	SpanId     string         `json:"span_id"`
+	ParentId   string         `json:"parent_id,omitempty"`
+	TraceState string         `json:"trace_state,omitempty"`
+	Kind       string         `json:"kind"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	Status     string         `json:"status"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Resource   map[string]any `json:"resource,omitempty"`
+	Events     []eventRecord  `json:"events,omitempty"`
+}
+
+// eventRecord is the JSON representation of a span event in the file.
+type eventRecord struct {
+	Name       string         `json:"name"`
+	Time       time.Time      `json:"time"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// newSpanRecord creates the JSON representation of a span.
+func newSpanRecord(sp sdktrace.ReadOnlySpan) spanRecord {
+	sc := sp.SpanContext()
+	rec := spanRecord{
+		Name:       sp.Name(),
+		TraceId:    sc.TraceID().String(),
+		SpanId:     sc.SpanID().String(),
+		TraceState: sc.TraceState().String(),
+		Kind:       sp.SpanKind().String(),
+		Start:      sp.StartTime(),
+		End:        sp.EndTime(),
+		Status:     sp.Status().Code.String(),
+		Attributes: attributeMap(sp.Attributes()),
+	}
+	if p := sp.Parent(); p.HasSpanID() {
+		rec.ParentId = p.SpanID().String()
+	}
+	if res := sp.Resource(); res != nil {
+		rec.Resource = attributeMap(res.Attributes())
+	}
+	for _, ev := range sp.Events() {
+		rec.Events = append(rec.Events, eventRecord{
+			Name:       ev.Name,
+			Time:       ev.Time,
+			Attributes: attributeMap(ev.Attributes),
+		})
+	}
+	return rec
+}
+
+// attributeMap converts attributes to a map of their values.
+func attributeMap(attrs []attribute.KeyValue) map[string]any {
+	if len(attrs) == 0 {
+		return nil
+	}
+	m := make(map[string]any, len(attrs))
+	for _, kv := range attrs {
+		m[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	return m
+}
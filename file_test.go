@@ -0,0 +1,57 @@
+package trace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestFileExporterRenameFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	exp, err := NewFileExporter(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exp.Shutdown(context.Background())
+
+	mem := NewInMemoryExporter()
+	trc, err := NewTraceCore(
+		[]sdktrace.SpanExporter{mem},
+		WithCryptoRandom(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trc.Close()
+	endSpan(t, trc, "first")
+	endSpan(t, trc, "second")
+	endSpan(t, trc, "third")
+	spans := mem.Spans()
+	ctx := context.Background()
+
+	if err := exp.ExportSpans(ctx, spans[:1]); err != nil {
+		t.Fatal(err)
+	}
+	// Renaming a file that no longer exists fails.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := exp.ExportSpans(ctx, spans[1:2]); err == nil {
+		t.Fatal("rotation did not fail")
+	}
+	if err := exp.ExportSpans(ctx, spans[2:]); err != nil {
+		t.Fatalf("exporter is unusable after a failed rotation: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"third"`) {
+		t.Errorf("file does not contain the span: %s", data)
+	}
+}
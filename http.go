@@ -0,0 +1,259 @@
+package trace
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServerDurationKey is the attribute key of the time in seconds it took the
+// server to handle the request.
+const ServerDurationKey = attribute.Key("http.server.duration")
+
+// HTTPConfiguration is a collection of options that apply to the middleware.
+type HTTPConfiguration struct {
+	disabled  map[attribute.Key]bool
+	kind      trace.SpanKind
+	sensitive []string
+}
+
+// newHTTPConfiguration creates default configs and applies options
+func newHTTPConfiguration(opts []HTTPOption) *HTTPConfiguration {
+	cfg := &HTTPConfiguration{
+		disabled: map[attribute.Key]bool{},
+	}
+
+	for _, opt := range opts {
+		opt.ConfigureHTTP(cfg)
+	}
+
+	return cfg
+}
+
+// HTTPOption defines objects that can change an HTTPConfiguration.
+type HTTPOption interface {
+	ConfigureHTTP(c *HTTPConfiguration)
+}
+
+// WithoutHTTPAttributes creates an option for not setting some of the
+// attributes that the middleware sets on server spans by default, such as
+// semconv.URLPathKey or ServerDurationKey.
+func WithoutHTTPAttributes(keys ...attribute.Key) HTTPOption {
+	return &withoutAttributesOption{
+		keys: keys,
+	}
+}
+
+type withoutAttributesOption struct {
+	keys []attribute.Key
+}
+
+func (o *withoutAttributesOption) ConfigureHTTP(c *HTTPConfiguration) {
+	for _, k := range o.keys {
+		c.disabled[k] = true
+	}
+}
+
+// WithSensitiveQueryKeys creates an option for redacting the values of the
+// query parameters with the given names in the semconv.URLQueryKey attribute
+// instead of DefaultSensitiveQueryKeys.
+func WithSensitiveQueryKeys(keys ...string) HTTPOption {
+	return &sensitiveKeysOption{
+		keys: keys,
+	}
+}
+
+type sensitiveKeysOption struct {
+	keys []string
+}
+
+func (o *sensitiveKeysOption) ConfigureHTTP(c *HTTPConfiguration) {
+	c.sensitive = o.keys
+}
+
+// WithSpanKind creates an option for setting the kind of the server spans
+// instead of inferring it from the request with HTTPSpanKind.
+func WithSpanKind(kind trace.SpanKind) HTTPOption {
+	return &spanKindOption{
+		kind: kind,
+	}
+}
+
+type spanKindOption struct {
+	kind trace.SpanKind
+}
+
+func (o *spanKindOption) ConfigureHTTP(c *HTTPConfiguration) {
+	c.kind = o.kind
+}
+
+// SpanKind returns the kind of a span for an operation between services.
+// Outgoing operations are clients, or producers if they do not wait for a
+// response. Incoming operations are servers, or consumers if the caller does
+// not wait for a response.
+func SpanKind(outgoing bool, async bool) trace.SpanKind {
+	switch {
+	case outgoing && async:
+		return trace.SpanKindProducer
+	case outgoing:
+		return trace.SpanKindClient
+	case async:
+		return trace.SpanKindConsumer
+	default:
+		return trace.SpanKindServer
+	}
+}
+
+// HTTPSpanKind returns the kind of a span for an incoming or outgoing http
+// request with SpanKind. A request is asynchronous if it has the
+// "Prefer: respond-async" header of RFC 7240.
+func HTTPSpanKind(r *http.Request, outgoing bool) trace.SpanKind {
+	async := false
+	for _, v := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(pref), "respond-async") {
+				async = true
+			}
+		}
+	}
+	return SpanKind(outgoing, async)
+}
+
+// ExtractHTTP decodes the traceparent and tracestate headers of the request
+// and returns the trace info of the remote span and the trace flags.
+func ExtractHTTP(r *http.Request) (*TraceInfo, byte, error) {
+	carrier := propagation.HeaderCarrier(r.Header)
+	return TraceContextPropagator{}.Extract(carrier)
+}
+
+// InjectHTTP sets the traceparent and tracestate headers of the span of the
+// trace info in the header, replacing their previous values and leaving the
+// other headers intact. If the trace info has no tracestate, the tracestate
+// header is removed.
+func InjectHTTP(h http.Header, inf *TraceInfo, flg byte) {
+	h.Set(TraceparentHeader, inf.Traceparent(flg))
+	if inf.state != "" {
+		h.Set(TracestateHeader, inf.state)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+// InjectHTTPIfAbsent works like InjectHTTP, but it leaves the header as it is
+// if it already has a traceparent. It reports whether the header was changed.
+func InjectHTTPIfAbsent(h http.Header, inf *TraceInfo, flg byte) bool {
+	if h.Get(TraceparentHeader) != "" {
+		return false
+	}
+	InjectHTTP(h, inf, flg)
+	return true
+}
+
+// HTTPMiddleware creates a handler that records a server span for each
+// request handled by the next handler. The trace is continued from the
+// traceparent header of the request, or a new trace is started if it has
+// none. The trace info of the span is stored in the request's context. The
+// kind of the span is inferred with HTTPSpanKind, unless it is set by an
+// option.
+//
+// The span has the request method, url path, response status code and the
+// server duration as attributes, unless they are disabled by options. The
+// query string is added with the values of sensitive parameters redacted.
+func (trc *TraceCore) HTTPMiddleware(
+	next http.Handler,
+	opts ...HTTPOption,
+) http.Handler {
+	cfg := newHTTPConfiguration(opts)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var inf *TraceInfo
+		remote, flg, err := ExtractHTTP(r)
+		if err != nil {
+			inf, flg = trc.CreateRoot()
+		} else {
+			inf = trc.CreateChild(remote)
+		}
+
+		kind := cfg.kind
+		if kind == trace.SpanKindUnspecified {
+			kind = HTTPSpanKind(r, false)
+		}
+
+		span := trc.NewSpan(r.Method, inf, flg).SetKind(kind)
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		ctx := ContextWithTraceInfo(r.Context(), inf, flg)
+
+		start := trc.clock.Now()
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		dur := trc.clock.Now().Sub(start)
+
+		attribs := []attribute.KeyValue{
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.URLPathKey.String(r.URL.Path),
+			semconv.HTTPResponseStatusCodeKey.Int(sw.status),
+			ServerDurationKey.Float64(dur.Seconds()),
+		}
+		if r.URL.RawQuery != "" {
+			query := RedactQuery(r.URL.RawQuery, cfg.sensitive...)
+			attribs = append(attribs, semconv.URLQueryKey.String(query))
+		}
+		for _, kv := range attribs {
+			if !cfg.disabled[kv.Key] {
+				span.SetAttributes(kv)
+			}
+		}
+		success := sw.status < http.StatusInternalServerError
+		if err := span.End(success); err != nil {
+			trc.onError(err)
+		}
+	})
+}
+
+// statusWriter records the status code written to a response writer.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.status, w.wrote = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends the buffered data to the client if the original response writer
+// supports flushing, so that streaming handlers keep working.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wrote = true
+		f.Flush()
+	}
+}
+
+// Hijack lets the handler take over the connection if the original response
+// writer supports it, such as for websockets.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the original response writer for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
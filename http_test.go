@@ -0,0 +1,130 @@
+package trace
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestHTTPMiddlewareInvalidTracestate(t *testing.T) {
+	var errs []error
+	exp := NewInMemoryExporter()
+	trc, err := NewTraceCore(
+		[]sdktrace.SpanExporter{exp},
+		WithCryptoRandom(),
+		WithErrorHandler(func(err error) { errs = append(errs, err) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var state string
+	handler := trc.HTTPMiddleware(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			inf, _ := TraceInfoFromContext(r.Context())
+			state = inf.TraceState()
+		},
+	))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(TraceparentHeader,
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	req.Header.Set(TracestateHeader, "INVALID KEY=1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if state != "" {
+		t.Errorf("got tracestate %q, want it discarded", state)
+	}
+	if len(errs) != 0 {
+		t.Errorf("got errors %v", errs)
+	}
+	spans := exp.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("exported %d spans, want 1", len(spans))
+	}
+	tid := spans[0].SpanContext().TraceID().String()
+	if tid != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("got trace id %s", tid)
+	}
+}
+
+func TestExtractHTTPNormalizesTracestate(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(TraceparentHeader,
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	req.Header.Set(TracestateHeader, "foo=1 ,, bar=2")
+
+	inf, _, err := ExtractHTTP(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := inf.TraceState(); state != "foo=1,bar=2" {
+		t.Errorf("got tracestate %q, want %q", state, "foo=1,bar=2")
+	}
+}
+
+func TestHTTPMiddlewareReportsEndErrors(t *testing.T) {
+	var errs []error
+	trc, err := NewTraceCore(
+		[]sdktrace.SpanExporter{NewInMemoryExporter()},
+		WithCryptoRandom(),
+		WithErrorHandler(func(err error) { errs = append(errs, err) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := trc.HTTPMiddleware(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {},
+	))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(errs) != 1 || !errors.Is(errs[0], ErrClosed) {
+		t.Errorf("got errors %v, want %v", errs, ErrClosed)
+	}
+}
+
+func TestHTTPMiddlewareKeepsFlusherAndHijacker(t *testing.T) {
+	trc, err := NewTraceCore(
+		[]sdktrace.SpanExporter{NewInMemoryExporter()},
+		WithCryptoRandom(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trc.Close()
+
+	var flusher, hijacker bool
+	var hijackErr error
+	handler := trc.HTTPMiddleware(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var f http.Flusher
+			f, flusher = w.(http.Flusher)
+			if flusher {
+				f.Flush()
+			}
+			var h http.Hijacker
+			if h, hijacker = w.(http.Hijacker); hijacker {
+				_, _, hijackErr = h.Hijack()
+			}
+		},
+	))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !flusher || !rec.Flushed {
+		t.Error("response writer was not flushed through the middleware")
+	}
+	if !hijacker || !errors.Is(hijackErr, http.ErrNotSupported) {
+		t.Errorf("got hijacker %v and error %v", hijacker, hijackErr)
+	}
+}
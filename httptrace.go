@@ -0,0 +1,61 @@
+package trace
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ClientTrace creates an httptrace.ClientTrace that records the connection
+// phases of an outgoing request as events on the client span, such as the
+// DNS lookup, connecting, the TLS handshake and the first response byte.
+// Attach it to the request's context with httptrace.WithClientTrace.
+func ClientTrace(b *SpanBuilder) *httptrace.ClientTrace {
+	withErr := func(attrs []attribute.KeyValue, err error) []attribute.KeyValue {
+		if err != nil {
+			attrs = append(attrs, attribute.String("error", err.Error()))
+		}
+		return attrs
+	}
+
+	return &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			b.AddEvent("http.get_conn", attribute.String("net.peer", hostPort))
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			b.AddEvent("http.got_conn", attribute.Bool("reused", info.Reused))
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			b.AddEvent("http.dns.start", attribute.String("host", info.Host))
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			b.AddEvent("http.dns.done", withErr(nil, info.Err)...)
+		},
+		ConnectStart: func(network, addr string) {
+			b.AddEvent("http.connect.start",
+				attribute.String("network", network),
+				attribute.String("address", addr),
+			)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			attrs := []attribute.KeyValue{
+				attribute.String("network", network),
+				attribute.String("address", addr),
+			}
+			b.AddEvent("http.connect.done", withErr(attrs, err)...)
+		},
+		TLSHandshakeStart: func() {
+			b.AddEvent("http.tls.start")
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			b.AddEvent("http.tls.done", withErr(nil, err)...)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			b.AddEvent("http.wrote_request", withErr(nil, info.Err)...)
+		},
+		GotFirstResponseByte: func() {
+			b.AddEvent("http.first_byte")
+		},
+	}
+}
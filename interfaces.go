@@ -1,5 +1,21 @@
 package trace
 
+import "time"
+
 type Random interface {
 	Fill([]byte) []byte
 }
+
+// Clock provides the current time and timers to the trace service, so that
+// time can be controlled in tests.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer created by a Clock, which works like time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
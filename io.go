@@ -0,0 +1,52 @@
+package trace
+
+import (
+	"io"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// BytesReadKey is the attribute key of the number of bytes read from a
+// wrapped reader.
+const BytesReadKey = attribute.Key("io.bytes_read")
+
+// WrapReadCloser returns a read closer that ends the span when it is closed,
+// which measures the time until a streamed body is consumed rather than the
+// time until the handler returns. The span gets the number of bytes read as
+// an attribute, and it fails if a read returned an error other than io.EOF.
+func WrapReadCloser(span *SpanBuilder, rc io.ReadCloser) io.ReadCloser {
+	return &spanReadCloser{
+		ReadCloser: rc,
+		span:       span,
+		once:       &sync.Once{},
+	}
+}
+
+type spanReadCloser struct {
+	io.ReadCloser
+	span *SpanBuilder
+	once *sync.Once
+	n    int64
+	err  error
+}
+
+func (r *spanReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *spanReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(func() {
+		r.span.SetAttributes(BytesReadKey.Int64(r.n))
+		if err := r.span.End(r.err == nil); err != nil {
+			r.span.core.onError(err)
+		}
+	})
+	return err
+}
@@ -1,16 +1,52 @@
 package trace
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/Soreing/grand"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
 )
 
 // Configuration is a collection of options that apply to the client.
 type Configuration struct {
 	rand       Random
+	randomIds  bool
 	batchTime  time.Duration
 	batchCount int
+	parallel   bool
+	strict     bool
+	onError    func(error)
+	resource   *resource.Resource
+	workers    int
+	aliases    []attribute.Key
+	observe    func(name string, d time.Duration)
+	sampler    Sampler
+	keepErrors bool
+	parentKey  attribute.Key
+	expvarName string
+	utf8Mode   UTF8Mode
+	defaults   []attribute.KeyValue
+
+	queueSize        int
+	backpressure     bool
+	backpressureWait time.Duration
+	maxBatchBytes    int
+	idleTime         time.Duration
+
+	dedupWindow time.Duration
+	dedupSize   int
+	onFlush     func(int)
+	maxHops     int
+	clock       Clock
+	dropReport  time.Duration
+	rateKey     string
+	rateField   string
+	prefix      []byte
+	rateWindow  time.Duration
+	jitter      time.Duration
+	middleware  []ExporterMiddleware
 }
 
 // newConfiguration creates default configs and applies options
@@ -18,6 +54,9 @@ func newConfiguration(opts []Option) (*Configuration, error) {
 	cfg := &Configuration{
 		batchTime:  0,
 		batchCount: 0,
+		onError:    func(error) {},
+		workers:    1,
+		clock:      systemClock{},
 	}
 
 	for _, opt := range opts {
@@ -25,11 +64,17 @@ func newConfiguration(opts []Option) (*Configuration, error) {
 	}
 
 	if cfg.rand == nil {
-		src, err := grand.NewSource()
-		if err != nil {
-			return nil, err
+		cfg.randomIds = true
+		// The default source only fails when the system provides no
+		// entropy, in which case crypto/rand fails as well. The trace
+		// service should not fail to start because of it, so it falls
+		// back to math/rand.
+		if src, err := grand.NewSource(); err != nil {
+			cfg.onError(fmt.Errorf("random source, using math/rand: %w", err))
+			cfg.rand = newMathRandom()
+		} else {
+			cfg.rand = grand.New(src)
 		}
-		cfg.rand = grand.New(src)
 	}
 
 	return cfg, nil
@@ -47,7 +92,21 @@ func UseRandomizer(rand Random) Option {
 	}
 }
 
+// WithCryptoRandom creates an option for generating ids with entropy from
+// crypto/rand instead of the default grand source. Ids are unpredictable, but
+// generating them is considerably slower and may block on system calls.
+func WithCryptoRandom() Option {
+	return &randOption{
+		rand:   cryptoRandom{},
+		random: true,
+	}
+}
+
 // UseBatching creates an option for batching spans before dispatching them.
+// A batch is exported when it has been open for maxTime or when it has
+// maxCount spans, whichever happens first. If maxCount is zero or less, there
+// is no count limit and batches are only exported on the timer. If maxTime is
+// zero or less, or maxCount is one, spans are not batched.
 func UseBatching(maxTime time.Duration, maxCount int) Option {
 	return &batchOption{
 		batchTime:  maxTime,
@@ -55,12 +114,263 @@ func UseBatching(maxTime time.Duration, maxCount int) Option {
 	}
 }
 
+// UseParallelExport creates an option for exporting spans to each exporter
+// concurrently instead of one after the other. Each exporter has a queue and
+// a goroutine of its own, so that a slow exporter does not delay the others
+// or the spans being dispatched. When the queue of an exporter is full, its
+// spans are dropped for that exporter and the error handler is notified.
+func UseParallelExport() Option {
+	return &parallelOption{}
+}
+
+// WithStrictValidation creates an option for validating spans before they are
+// dispatched. Spans with an invalid trace id, span id or an empty name are
+// rejected with an error instead of being exported.
+func WithStrictValidation() Option {
+	return &strictOption{}
+}
+
+// WithErrorHandler creates an option for handling errors that happen in the
+// background and can not be returned to the caller.
+func WithErrorHandler(handler func(error)) Option {
+	return &errorHandlerOption{
+		handler: handler,
+	}
+}
+
+// WithResource creates an option for setting the resource of the spans that
+// are started by the tracer.
+func WithResource(res *resource.Resource) Option {
+	return &resourceOption{
+		res: res,
+	}
+}
+
+// WithExportConcurrency creates an option for exporting batches of spans with
+// a pool of n workers, so that several batches can be handed over to the
+// exporters at the same time. Each exporter still receives one batch at a
+// time, so the workers only overlap when there are several exporters. It only
+// applies when batching is used. The default is 1.
+func WithExportConcurrency(n int) Option {
+	return &concurrencyOption{
+		workers: n,
+	}
+}
+
+// WithServiceNameAliases creates an option for setting the service name of
+// created resources under additional attribute keys besides service.name.
+func WithServiceNameAliases(keys ...string) Option {
+	return &aliasOption{
+		keys: keys,
+	}
+}
+
+// WithDurationObserver creates an option for observing the name and duration
+// of each span when it is dispatched, such as for feeding a latency metric.
+func WithDurationObserver(observe func(name string, d time.Duration)) Option {
+	return &observerOption{
+		observe: observe,
+	}
+}
+
+// WithQueueSize creates an option for queueing up to n spans while they wait
+// to be added to a batch. When the queue is full, dispatched spans are
+// dropped. Without a queue, dispatching a span waits until the batcher is
+// ready to receive it. It only applies when batching is used.
+func WithQueueSize(n int) Option {
+	return &queueOption{
+		size: n,
+	}
+}
+
+// WithBackpressure creates an option for waiting up to the timeout for space
+// in a full queue instead of dropping spans. If the timeout is not positive,
+// DefaultBackpressureTimeout is used. The wait is always bounded, because a
+// span dispatched from an exporter would otherwise wait forever for the queue
+// that the exporter is blocking. It only applies when a queue is used.
+func WithBackpressure(timeout time.Duration) Option {
+	return &backpressureOption{
+		timeout: timeout,
+	}
+}
+
+// WithSampler creates an option for deciding whether new traces are sampled.
+// Without a sampler, every new trace is sampled.
+func WithSampler(s Sampler) Option {
+	return &samplerOption{
+		sampler: s,
+	}
+}
+
+// WithKeepErrors creates an option for dispatching spans that ended with an
+// error even if their trace is not sampled.
+func WithKeepErrors() Option {
+	return &keepErrorsOption{}
+}
+
+// WithParentIdAttribute creates an option for adding the parent id of spans
+// as a hex string attribute with the key, for backends that do not link spans
+// to their parents otherwise. Root spans do not get the attribute.
+func WithParentIdAttribute(key string) Option {
+	return &parentKeyOption{
+		key: attribute.Key(key),
+	}
+}
+
+// WithExpvar creates an option for publishing the counters of the tracer as
+// an expvar variable with the name, which is served on /debug/vars.
+func WithExpvar(prefix string) Option {
+	return &expvarOption{
+		name: prefix,
+	}
+}
+
+// WithUTF8Validation creates an option for validating that span names and
+// string attributes are valid UTF-8 when spans are built, and handling the
+// invalid ones according to the mode.
+func WithUTF8Validation(mode UTF8Mode) Option {
+	return &utf8Option{
+		mode: mode,
+	}
+}
+
+// WithDefaultSpanAttributes creates an option for adding attributes to every
+// dispatched span. Attributes set on a span take precedence over the defaults
+// with the same key.
+func WithDefaultSpanAttributes(attrs ...attribute.KeyValue) Option {
+	return &defaultAttributesOption{
+		attrs: attrs,
+	}
+}
+
+// WithMaxBatchBytes creates an option for limiting the size of batches to n
+// bytes. The size of spans is estimated from the length of their names and
+// attributes, and a batch is exported before adding a span would exceed the
+// limit. A span larger than the limit is exported in a batch of its own.
+func WithMaxBatchBytes(n int) Option {
+	return &batchBytesOption{
+		bytes: n,
+	}
+}
+
+// WithIdleFlush creates an option for exporting a partial batch when no spans
+// are dispatched for the idle time, instead of waiting for the batch time to
+// elapse. It only applies when batching is used.
+func WithIdleFlush(idle time.Duration) Option {
+	return &idleOption{
+		idle: idle,
+	}
+}
+
+// WithDuplicateFilter creates an option for dropping spans whose span id was
+// already dispatched within the time window, which protects the backend from
+// instrumentation that dispatches the same span repeatedly. The span ids of
+// the latest size spans are remembered.
+func WithDuplicateFilter(window time.Duration, size int) Option {
+	return &dedupOption{
+		window: window,
+		size:   size,
+	}
+}
+
+// WithFlushCallback creates an option for calling a function with the number
+// of spans after each batch is exported to all the exporters. The function is
+// called synchronously by the goroutine that exported the batch.
+func WithFlushCallback(fn func(n int)) Option {
+	return &flushCallbackOption{
+		fn: fn,
+	}
+}
+
+// WithMaxHops creates an option for counting the services a trace passes
+// through in the tracestate, and reporting traces that pass through more than
+// max services to the error handler, which helps to catch infinite loops of
+// calls between services. The hop counter is read with TraceInfo.Hops.
+func WithMaxHops(max int) Option {
+	return &maxHopsOption{
+		max: max,
+	}
+}
+
+// WithClock creates an option for setting the clock that provides the times
+// of spans and the timers of batching, such as a manual clock in tests.
+func WithClock(clock Clock) Option {
+	return &clockOption{
+		clock: clock,
+	}
+}
+
+// WithDropReport creates an option for dispatching a diagnostic span every
+// interval in which spans were dropped, with the number of spans dropped since
+// the last report, so that lost spans are visible in the tracing backend.
+func WithDropReport(interval time.Duration) Option {
+	return &dropReportOption{
+		interval: interval,
+	}
+}
+
+// WithTracestateSampling creates an option for reading a sampling rate from
+// the tracestate of spans, which overrides the decision of the local sampler
+// when the span ends. The rate is the value of the key in the tracestate, or
+// if field is set, the value of the field in a list of field:value pairs
+// separated by semicolons, such as "s" in "dd=s:1;o:rum". Rates of 1 or more
+// keep the span, rates of 0 or less drop it, and fractions in between sample
+// the trace consistently by its trace id.
+func WithTracestateSampling(key string, field string) Option {
+	return &tracestateSamplingOption{
+		key:   key,
+		field: field,
+	}
+}
+
+// WithTraceIdPrefix creates an option for generating trace ids whose high
+// bytes are the prefix, such as an organization id for routing traces, with
+// the rest of the bytes random. Prefixes are limited to MaxTraceIdPrefix
+// bytes, so that the low bytes of the trace id stay random as the random
+// trace id flag requires. Longer prefixes are truncated.
+func WithTraceIdPrefix(prefix []byte) Option {
+	if len(prefix) > MaxTraceIdPrefix {
+		prefix = prefix[:MaxTraceIdPrefix]
+	}
+	return &prefixOption{
+		prefix: append([]byte{}, prefix...),
+	}
+}
+
+// WithSampleRateWindow creates an option for measuring the ratio of the ended
+// spans that were sampled over a sliding window of time, which is reported by
+// TraceCore.SampleRate.
+func WithSampleRateWindow(window time.Duration) Option {
+	return &rateWindowOption{
+		window: window,
+	}
+}
+
+// WithFlushJitter creates an option for adding a random delay of up to max to
+// each batch time, which spreads out the exports of many processes that would
+// otherwise export their batches at the same time.
+func WithFlushJitter(max time.Duration) Option {
+	return &jitterOption{
+		max: max,
+	}
+}
+
+// WithExporterMiddleware creates an option for wrapping each exporter of the
+// trace service with the middleware, as with ChainExporter.
+func WithExporterMiddleware(mws ...ExporterMiddleware) Option {
+	return &middlewareOption{
+		mws: mws,
+	}
+}
+
 type randOption struct {
-	rand Random
+	rand   Random
+	random bool
 }
 
 func (o *randOption) Configure(c *Configuration) {
 	c.rand = o.rand
+	c.randomIds = o.random
 }
 
 type batchOption struct {
@@ -72,3 +382,226 @@ func (o *batchOption) Configure(c *Configuration) {
 	c.batchTime = o.batchTime
 	c.batchCount = o.batchCount
 }
+
+type parallelOption struct{}
+
+func (o *parallelOption) Configure(c *Configuration) {
+	c.parallel = true
+}
+
+type strictOption struct{}
+
+func (o *strictOption) Configure(c *Configuration) {
+	c.strict = true
+}
+
+type errorHandlerOption struct {
+	handler func(error)
+}
+
+func (o *errorHandlerOption) Configure(c *Configuration) {
+	if o.handler != nil {
+		c.onError = o.handler
+	}
+}
+
+type resourceOption struct {
+	res *resource.Resource
+}
+
+func (o *resourceOption) Configure(c *Configuration) {
+	c.resource = o.res
+}
+
+type concurrencyOption struct {
+	workers int
+}
+
+func (o *concurrencyOption) Configure(c *Configuration) {
+	if o.workers > 0 {
+		c.workers = o.workers
+	}
+}
+
+type aliasOption struct {
+	keys []string
+}
+
+func (o *aliasOption) Configure(c *Configuration) {
+	for _, k := range o.keys {
+		c.aliases = append(c.aliases, attribute.Key(k))
+	}
+}
+
+type observerOption struct {
+	observe func(name string, d time.Duration)
+}
+
+func (o *observerOption) Configure(c *Configuration) {
+	c.observe = o.observe
+}
+
+type queueOption struct {
+	size int
+}
+
+func (o *queueOption) Configure(c *Configuration) {
+	if o.size > 0 {
+		c.queueSize = o.size
+	}
+}
+
+type backpressureOption struct {
+	timeout time.Duration
+}
+
+func (o *backpressureOption) Configure(c *Configuration) {
+	c.backpressure = true
+	c.backpressureWait = o.timeout
+}
+
+type samplerOption struct {
+	sampler Sampler
+}
+
+func (o *samplerOption) Configure(c *Configuration) {
+	c.sampler = o.sampler
+}
+
+type keepErrorsOption struct{}
+
+func (o *keepErrorsOption) Configure(c *Configuration) {
+	c.keepErrors = true
+}
+
+type parentKeyOption struct {
+	key attribute.Key
+}
+
+func (o *parentKeyOption) Configure(c *Configuration) {
+	c.parentKey = o.key
+}
+
+type expvarOption struct {
+	name string
+}
+
+func (o *expvarOption) Configure(c *Configuration) {
+	c.expvarName = o.name
+}
+
+type utf8Option struct {
+	mode UTF8Mode
+}
+
+func (o *utf8Option) Configure(c *Configuration) {
+	c.utf8Mode = o.mode
+}
+
+type defaultAttributesOption struct {
+	attrs []attribute.KeyValue
+}
+
+func (o *defaultAttributesOption) Configure(c *Configuration) {
+	c.defaults = append(c.defaults, o.attrs...)
+}
+
+type batchBytesOption struct {
+	bytes int
+}
+
+func (o *batchBytesOption) Configure(c *Configuration) {
+	c.maxBatchBytes = o.bytes
+}
+
+type idleOption struct {
+	idle time.Duration
+}
+
+func (o *idleOption) Configure(c *Configuration) {
+	c.idleTime = o.idle
+}
+
+type dedupOption struct {
+	window time.Duration
+	size   int
+}
+
+func (o *dedupOption) Configure(c *Configuration) {
+	c.dedupWindow = o.window
+	c.dedupSize = o.size
+}
+
+type flushCallbackOption struct {
+	fn func(int)
+}
+
+func (o *flushCallbackOption) Configure(c *Configuration) {
+	c.onFlush = o.fn
+}
+
+type maxHopsOption struct {
+	max int
+}
+
+func (o *maxHopsOption) Configure(c *Configuration) {
+	c.maxHops = o.max
+}
+
+type clockOption struct {
+	clock Clock
+}
+
+func (o *clockOption) Configure(c *Configuration) {
+	c.clock = o.clock
+}
+
+type dropReportOption struct {
+	interval time.Duration
+}
+
+func (o *dropReportOption) Configure(c *Configuration) {
+	c.dropReport = o.interval
+}
+
+type tracestateSamplingOption struct {
+	key   string
+	field string
+}
+
+func (o *tracestateSamplingOption) Configure(c *Configuration) {
+	c.rateKey = o.key
+	c.rateField = o.field
+}
+
+type prefixOption struct {
+	prefix []byte
+}
+
+func (o *prefixOption) Configure(c *Configuration) {
+	c.prefix = o.prefix
+}
+
+type rateWindowOption struct {
+	window time.Duration
+}
+
+func (o *rateWindowOption) Configure(c *Configuration) {
+	c.rateWindow = o.window
+}
+
+type jitterOption struct {
+	max time.Duration
+}
+
+func (o *jitterOption) Configure(c *Configuration) {
+	c.jitter = o.max
+}
+
+type middlewareOption struct {
+	mws []ExporterMiddleware
+}
+
+func (o *middlewareOption) Configure(c *Configuration) {
+	c.middleware = append(c.middleware, o.mws...)
+}
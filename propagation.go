@@ -0,0 +1,213 @@
+package trace
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Environment variables that carry the trace context between processes, such
+// as command line tools started by each other.
+const (
+	TraceparentEnv = "TRACEPARENT"
+	TracestateEnv  = "TRACESTATE"
+)
+
+// FromEnvironment decodes the traceparent in the TRACEPARENT environment
+// variable and returns the trace info of the remote span and the trace flags.
+// The span id of the trace info is the parent id of the header, so NewChild
+// creates a span that continues the trace. The tracestate is read from the
+// TRACESTATE environment variable, if it is set.
+func FromEnvironment() (*TraceInfo, byte, error) {
+	header, ok := os.LookupEnv(TraceparentEnv)
+	if !ok {
+		return nil, 0, fmt.Errorf("traceparent not set")
+	}
+	return extractTraceparent(header, os.Getenv(TracestateEnv))
+}
+
+// extractTraceparent decodes a traceparent header and returns the trace info
+// of the remote span with the tracestate and the trace flags. An invalid
+// tracestate is discarded, as the w3c specification requires, and whitespace
+// and empty members are removed from a valid one. If the tracestate marks the
+// trace to be kept, the trace is sampled.
+func extractTraceparent(header, state string) (*TraceInfo, byte, error) {
+	_, tid, pid, flg, err := DecodeTraceparent(header)
+	if err != nil {
+		return nil, 0, err
+	}
+	state = normalizeTracestate(state)
+	if _, err := trace.ParseTraceState(state); err != nil {
+		state = ""
+	}
+	if isForceKept(state) {
+		flg |= FlagSampled
+	}
+	inf := newRemoteTraceInfo(tid, pid)
+	inf.state = state
+	return inf, flg, nil
+}
+
+// Propagator injects trace context into carriers and extracts it from them,
+// such as the headers of requests between services.
+type Propagator interface {
+	// Inject sets the trace context of the span of the trace info in the
+	// carrier.
+	Inject(carrier propagation.TextMapCarrier, inf *TraceInfo, flg byte)
+	// Extract returns the trace info of the remote span in the carrier and
+	// the trace flags.
+	Extract(carrier propagation.TextMapCarrier) (*TraceInfo, byte, error)
+}
+
+// Headers of the w3c trace context specification.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// TraceContextPropagator propagates trace context in w3c traceparent and
+// tracestate headers.
+type TraceContextPropagator struct{}
+
+// Inject sets the traceparent header in the carrier, and the tracestate
+// header if the trace info has a tracestate.
+func (TraceContextPropagator) Inject(
+	carrier propagation.TextMapCarrier,
+	inf *TraceInfo,
+	flg byte,
+) {
+	carrier.Set(TraceparentHeader, inf.Traceparent(flg))
+	if inf.state != "" {
+		carrier.Set(TracestateHeader, inf.state)
+	}
+}
+
+// Extract decodes the traceparent header in the carrier, and keeps the value
+// of the tracestate header in the trace info.
+func (TraceContextPropagator) Extract(
+	carrier propagation.TextMapCarrier,
+) (*TraceInfo, byte, error) {
+	header := carrier.Get(TraceparentHeader)
+	if header == "" {
+		return nil, 0, fmt.Errorf("traceparent not set")
+	}
+	return extractTraceparent(header, carrier.Get(TracestateHeader))
+}
+
+// B3 headers of the zipkin b3 propagation format.
+const (
+	B3Header        = "b3"
+	B3TraceIdHeader = "x-b3-traceid"
+	B3SpanIdHeader  = "x-b3-spanid"
+	B3SampledHeader = "x-b3-sampled"
+)
+
+// B3Propagator propagates trace context in zipkin b3 headers. It injects the
+// multiple header form and extracts either the single or multiple header
+// form. 64-bit trace ids are padded with zeros to 128 bits and injected as
+// 64-bit trace ids again. Span ids shorter than 16 hex digits are padded with
+// zeros on the left.
+type B3Propagator struct{}
+
+// Inject sets the b3 headers in the carrier.
+func (B3Propagator) Inject(
+	carrier propagation.TextMapCarrier,
+	inf *TraceInfo,
+	flg byte,
+) {
+	_, _, sid := inf.GetStringIds()
+	carrier.Set(B3TraceIdHeader, FormatTraceId(inf.tid, inf.short))
+	carrier.Set(B3SpanIdHeader, sid)
+	if IsSampled(flg) {
+		carrier.Set(B3SampledHeader, "1")
+	} else {
+		carrier.Set(B3SampledHeader, "0")
+	}
+}
+
+// Extract decodes the b3 headers in the carrier.
+func (B3Propagator) Extract(
+	carrier propagation.TextMapCarrier,
+) (*TraceInfo, byte, error) {
+	var tid, sid, sampled string
+	if header := carrier.Get(B3Header); header != "" {
+		parts := strings.Split(header, "-")
+		if len(parts) < 2 {
+			return nil, 0, ErrInvalidFormat
+		}
+		tid, sid = parts[0], parts[1]
+		if len(parts) > 2 {
+			sampled = parts[2]
+		}
+	} else {
+		tid = carrier.Get(B3TraceIdHeader)
+		sid = carrier.Get(B3SpanIdHeader)
+		sampled = carrier.Get(B3SampledHeader)
+	}
+
+	tid128, short, err := NormalizeTraceId(tid)
+	if err != nil {
+		return nil, 0, err
+	}
+	sid64, err := NormalizeSpanId(sid)
+	if err != nil {
+		return nil, 0, err
+	}
+	inf := &TraceInfo{tid: tid128, sid: sid64, remote: true, short: short}
+
+	var flg byte
+	switch sampled {
+	case "1", "d", "true":
+		flg = FlagSampled
+	case "", "0", "false":
+		flg = 0
+	default:
+		return nil, 0, fmt.Errorf("invalid sampling state")
+	}
+	return inf, flg, nil
+}
+
+// compositePropagator injects with all of its propagators and extracts with
+// the first one that succeeds.
+type compositePropagator struct {
+	props []Propagator
+}
+
+// NewCompositePropagator creates a propagator that injects trace context in
+// the formats of all the propagators, and extracts it with the first of the
+// propagators that succeeds.
+func NewCompositePropagator(props ...Propagator) Propagator {
+	return &compositePropagator{
+		props: append([]Propagator{}, props...),
+	}
+}
+
+// Inject sets the trace context in the carrier with every propagator.
+func (p *compositePropagator) Inject(
+	carrier propagation.TextMapCarrier,
+	inf *TraceInfo,
+	flg byte,
+) {
+	for _, prop := range p.props {
+		prop.Inject(carrier, inf, flg)
+	}
+}
+
+// Extract returns the trace context extracted by the first propagator that
+// succeeds, or the error of the last propagator if none of them succeed.
+func (p *compositePropagator) Extract(
+	carrier propagation.TextMapCarrier,
+) (*TraceInfo, byte, error) {
+	err := fmt.Errorf("no propagators")
+	for _, prop := range p.props {
+		var inf *TraceInfo
+		var flg byte
+		if inf, flg, err = prop.Extract(carrier); err == nil {
+			return inf, flg, nil
+		}
+	}
+	return nil, 0, err
+}
@@ -0,0 +1,130 @@
+package trace
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	mrand "math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RandomFunc is an adapter to allow the use of ordinary functions as Random.
+// The function is expected to fill the whole slice it receives.
+type RandomFunc func([]byte)
+
+// Fill calls f(dest) and returns dest.
+func (f RandomFunc) Fill(dest []byte) []byte {
+	f(dest)
+	return dest
+}
+
+type fixedRandom struct {
+	mtx  *sync.Mutex
+	seqs [][]byte
+	next int
+}
+
+// FixedRandom creates a Random that fills destinations with the preset byte
+// sequences in order, one sequence per call. Sequences shorter than the
+// destination are padded with zeros, longer ones are truncated. When all the
+// sequences are used up, it starts again from the first one.
+func FixedRandom(seqs [][]byte) Random {
+	cpy := make([][]byte, len(seqs))
+	for i := range seqs {
+		cpy[i] = append([]byte{}, seqs[i]...)
+	}
+	return &fixedRandom{
+		mtx:  &sync.Mutex{},
+		seqs: cpy,
+	}
+}
+
+// Fill copies the next preset sequence into dest and returns dest.
+func (r *fixedRandom) Fill(dest []byte) []byte {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	var seq []byte
+	if len(r.seqs) > 0 {
+		seq = r.seqs[r.next]
+		r.next = (r.next + 1) % len(r.seqs)
+	}
+
+	n := copy(dest, seq)
+	for i := n; i < len(dest); i++ {
+		dest[i] = 0
+	}
+	return dest
+}
+
+// SequentialRandom is a Random that fills destinations with the value of a
+// counter that is incremented on each call, which makes every generated id
+// unique within a run and cheap to create. It is meant for load tests and
+// benchmarks, not for production use. The zero value is ready to use and
+// starts counting from 1.
+type SequentialRandom struct {
+	counter atomic.Uint64
+}
+
+// Fill writes the next value of the counter into the last 8 bytes of dest in
+// big-endian order, zeros the rest and returns dest.
+func (r *SequentialRandom) Fill(dest []byte) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], r.counter.Add(1))
+
+	if len(dest) < 8 {
+		copy(dest, buf[8-len(dest):])
+		return dest
+	}
+	for i := 0; i < len(dest)-8; i++ {
+		dest[i] = 0
+	}
+	copy(dest[len(dest)-8:], buf[:])
+	return dest
+}
+
+// cryptoRandom is a Random that uses entropy from crypto/rand.
+type cryptoRandom struct{}
+
+// Fill fills dest with entropy from crypto/rand and returns dest. It panics
+// if crypto/rand fails, which does not happen on supported platforms.
+func (cryptoRandom) Fill(dest []byte) []byte {
+	if _, err := crand.Read(dest); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return dest
+}
+
+// mathRandom is a Random that uses a math/rand source. It is the fallback of
+// the default source when the system provides no entropy, so ids are not
+// unpredictable, but the trace service keeps working.
+type mathRandom struct {
+	mtx *sync.Mutex
+	rnd *mrand.Rand
+}
+
+// newMathRandom creates a math/rand Random seeded from the current time and
+// the process id, so that processes started at the same time differ.
+func newMathRandom() *mathRandom {
+	seed := time.Now().UnixNano() ^ int64(os.Getpid())<<32
+	return &mathRandom{
+		mtx: &sync.Mutex{},
+		rnd: mrand.New(mrand.NewSource(seed)),
+	}
+}
+
+// Fill fills dest with bytes from the math/rand source and returns dest.
+func (r *mathRandom) Fill(dest []byte) []byte {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	var buf [8]byte
+	for i := 0; i < len(dest); i += 8 {
+		binary.BigEndian.PutUint64(buf[:], r.rnd.Uint64())
+		copy(dest[i:], buf[:])
+	}
+	return dest
+}
@@ -0,0 +1,21 @@
+package trace
+
+import "testing"
+
+func TestMathRandomFill(t *testing.T) {
+	r := newMathRandom()
+	seen := map[[16]byte]bool{}
+	for i := 0; i < 100; i++ {
+		var tid [16]byte
+		r.Fill(tid[:])
+		if tid == [16]byte{} || seen[tid] {
+			t.Fatalf("got repeated or zero id %x", tid)
+		}
+		seen[tid] = true
+	}
+
+	var odd [5]byte
+	if r.Fill(odd[:]); odd == [5]byte{} {
+		t.Error("short destination was not filled")
+	}
+}
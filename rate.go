@@ -0,0 +1,71 @@
+package trace
+
+import (
+	"sync"
+	"time"
+)
+
+// rateBuckets is the number of buckets of a sample rate window.
+const rateBuckets = 10
+
+// rateWindow counts the sampled and total spans over a sliding window of
+// time, which is divided into buckets that expire one at a time.
+type rateWindow struct {
+	mtx     *sync.Mutex
+	clock   Clock
+	width   time.Duration
+	buckets [rateBuckets]rateBucket
+}
+
+// rateBucket counts the spans ended in a slice of the window.
+type rateBucket struct {
+	start   time.Time
+	sampled uint64
+	total   uint64
+}
+
+// newRateWindow creates a sliding window of the given length.
+func newRateWindow(clock Clock, window time.Duration) *rateWindow {
+	width := window / rateBuckets
+	if width <= 0 {
+		width = 1
+	}
+	return &rateWindow{
+		mtx:   &sync.Mutex{},
+		clock: clock,
+		width: width,
+	}
+}
+
+// record counts an ended span and whether it was sampled.
+func (w *rateWindow) record(sampled bool) {
+	now := w.clock.Now()
+	start := now.Truncate(w.width)
+	idx := (now.UnixNano() / int64(w.width)) % rateBuckets
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	b := &w.buckets[idx]
+	if !b.start.Equal(start) {
+		*b = rateBucket{start: start}
+	}
+	b.total++
+	if sampled {
+		b.sampled++
+	}
+}
+
+// counts returns the number of sampled and total spans in the window.
+func (w *rateWindow) counts() (sampled, total uint64) {
+	oldest := w.clock.Now().Truncate(w.width).Add(-w.width * (rateBuckets - 1))
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	for _, b := range w.buckets {
+		if !b.start.Before(oldest) {
+			sampled += b.sampled
+			total += b.total
+		}
+	}
+	return sampled, total
+}
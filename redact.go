@@ -0,0 +1,55 @@
+package trace
+
+import (
+	"net/url"
+	"strings"
+)
+
+// RedactedValue replaces the values of sensitive query parameters.
+const RedactedValue = "REDACTED"
+
+// DefaultSensitiveQueryKeys are the names of the query parameters that are
+// redacted by default. Names are matched case-insensitively.
+var DefaultSensitiveQueryKeys = []string{
+	"token", "access_token", "apikey", "api_key", "password", "secret", "sig",
+}
+
+// RedactURL returns the url as a string with the values of the sensitive
+// query parameters replaced by RedactedValue, and the password of the user
+// info, if any, redacted. If no keys are given, DefaultSensitiveQueryKeys
+// are used. The order and encoding of the other parameters are kept.
+func RedactURL(u *url.URL, keys ...string) string {
+	cpy := *u
+	cpy.RawQuery = RedactQuery(u.RawQuery, keys...)
+	return cpy.Redacted()
+}
+
+// RedactQuery returns the raw query string with the values of the sensitive
+// parameters replaced like RedactURL.
+func RedactQuery(rawQuery string, keys ...string) string {
+	if rawQuery == "" {
+		return rawQuery
+	}
+	if len(keys) == 0 {
+		keys = DefaultSensitiveQueryKeys
+	}
+
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		raw, _, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		key, err := url.QueryUnescape(raw)
+		if err != nil {
+			key = raw
+		}
+		for _, k := range keys {
+			if strings.EqualFold(key, k) {
+				params[i] = raw + "=" + RedactedValue
+				break
+			}
+		}
+	}
+	return strings.Join(params, "&")
+}
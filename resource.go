@@ -0,0 +1,102 @@
+package trace
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// Attribute keys of the version control information of the build, which
+// have no semantic conventions.
+const (
+	VCSRevisionKey = attribute.Key("vcs.revision")
+	VCSTimeKey     = attribute.Key("vcs.time")
+	VCSModifiedKey = attribute.Key("vcs.modified")
+)
+
+// ResourceConfiguration is a collection of options that apply to the
+// resources created by the trace service.
+type ResourceConfiguration struct {
+	attribs []attribute.KeyValue
+}
+
+// newResourceConfiguration creates default configs and applies options
+func newResourceConfiguration(opts []ResourceOption) *ResourceConfiguration {
+	cfg := &ResourceConfiguration{}
+	for _, opt := range opts {
+		opt.ConfigureResource(cfg)
+	}
+	return cfg
+}
+
+// ResourceOption defines objects that can change a ResourceConfiguration.
+type ResourceOption interface {
+	ConfigureResource(c *ResourceConfiguration)
+}
+
+// WithResourceAttributes creates an option for adding attributes to the
+// resource. Unlike CreateResourceFromMap, the attributes keep their types,
+// such as ints, bools, floats and string slices.
+func WithResourceAttributes(attrs ...attribute.KeyValue) ResourceOption {
+	return &resourceAttributesOption{
+		attribs: attrs,
+	}
+}
+
+type resourceAttributesOption struct {
+	attribs []attribute.KeyValue
+}
+
+func (o *resourceAttributesOption) ConfigureResource(c *ResourceConfiguration) {
+	c.attribs = append(c.attribs, o.attribs...)
+}
+
+// WithProcessResource creates an option for adding the process id and the
+// name and version of the go runtime to the resource. Unlike the resource
+// detectors, it only sets attributes that are cheap to get and cannot fail.
+func WithProcessResource() ResourceOption {
+	return &processResourceOption{}
+}
+
+type processResourceOption struct{}
+
+func (o *processResourceOption) ConfigureResource(c *ResourceConfiguration) {
+	c.attribs = append(c.attribs,
+		semconv.ProcessPID(os.Getpid()),
+		semconv.ProcessRuntimeName("go"),
+		semconv.ProcessRuntimeVersion(runtime.Version()),
+	)
+}
+
+// WithBuildInfoResource creates an option for adding the version of the main
+// module as semconv.ServiceVersionKey, and the version control revision, time
+// and modified flag of the build, to the resource. The information is read
+// from the build info embedded in the binary, and missing values are skipped.
+func WithBuildInfoResource() ResourceOption {
+	return &buildInfoResourceOption{}
+}
+
+type buildInfoResourceOption struct{}
+
+func (o *buildInfoResourceOption) ConfigureResource(c *ResourceConfiguration) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		c.attribs = append(c.attribs, semconv.ServiceVersion(v))
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			c.attribs = append(c.attribs, VCSRevisionKey.String(setting.Value))
+		case "vcs.time":
+			c.attribs = append(c.attribs, VCSTimeKey.String(setting.Value))
+		case "vcs.modified":
+			c.attribs = append(c.attribs, VCSModifiedKey.Bool(setting.Value == "true"))
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package trace
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Sampler decides whether a new trace is sampled, based on its trace id and
+// the trace flags it was created with.
+type Sampler interface {
+	ShouldSample(tid [16]byte, flg byte) bool
+}
+
+// SpanSampler is a Sampler that also decides whether a span is dispatched when
+// it ends, based on its name and attributes. If the sampler of the trace
+// service is a SpanSampler, its decision at the end of a span replaces the
+// sampled bit of the span's trace flags.
+type SpanSampler interface {
+	Sampler
+	ShouldSampleSpan(
+		tid [16]byte,
+		flg byte,
+		name string,
+		attrs []attribute.KeyValue,
+	) bool
+}
+
+// TraceIDSamplingValue returns the value that the TraceIDRatioBased sampler of
+// open telemetry compares against its threshold. It is the low 8 bytes of the
+// trace id read in big-endian order and shifted right by one bit.
+func TraceIDSamplingValue(tid [16]byte) uint64 {
+	return binary.BigEndian.Uint64(tid[8:]) >> 1
+}
+
+// TraceIDRandomness returns the 63-bit value that the built-in samplers compare
+// against their threshold, so that custom samplers can make the same decision.
+// If the random trace id flag is set, the value is the low 7 bytes of the
+// trace id, which level 2 of the w3c trace context defines as random, shifted
+// left by 7 bits. Otherwise the trace id may not be random, so the value is
+// the first 8 bytes of the SHA-256 hash of the trace id shifted right by one
+// bit.
+func TraceIDRandomness(tid [16]byte, flg byte) uint64 {
+	if IsRandomTraceID(flg) {
+		return (binary.BigEndian.Uint64(tid[8:]) & (1<<56 - 1)) << 7
+	}
+	sum := sha256.Sum256(tid[:])
+	return binary.BigEndian.Uint64(sum[:8]) >> 1
+}
+
+// ratioSampler samples a fraction of the traces based on their trace id.
+type ratioSampler struct {
+	bound uint64
+}
+
+// NewRatioSampler creates a sampler that samples the given fraction of the
+// traces. Fractions of 1 or more sample every trace, fractions of 0 or less
+// sample none.
+func NewRatioSampler(fraction float64) Sampler {
+	switch {
+	case fraction >= 1:
+		return &ratioSampler{bound: 1 << 63}
+	case fraction <= 0:
+		return &ratioSampler{bound: 0}
+	default:
+		return &ratioSampler{bound: uint64(fraction * (1 << 63))}
+	}
+}
+
+// ShouldSample reports whether the randomness of the trace id falls within the
+// sampled ratio.
+func (s *ratioSampler) ShouldSample(tid [16]byte, flg byte) bool {
+	return TraceIDRandomness(tid, flg) < s.bound
+}
+
+// sampleRate reports whether a trace is sampled with a sampling rate, which
+// is consistent for the same trace id and with the ratio sampler. Rates of 1
+// or more sample every trace, rates of 0 or less sample none.
+func sampleRate(tid [16]byte, flg byte, rate float64) bool {
+	switch {
+	case rate >= 1:
+		return true
+	case rate <= 0:
+		return false
+	default:
+		return TraceIDRandomness(tid, flg) < uint64(rate*(1<<63))
+	}
+}
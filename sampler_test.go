@@ -0,0 +1,72 @@
+package trace
+
+import (
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestRatioSamplerMatchesSampleRate(t *testing.T) {
+	r := &SequentialRandom{}
+	s := NewRatioSampler(0.25)
+	for _, flg := range []byte{0, FlagRandom} {
+		sampled := 0
+		for i := 0; i < 10000; i++ {
+			var tid [16]byte
+			r.Fill(tid[:])
+			keep := s.ShouldSample(tid, flg)
+			if keep != sampleRate(tid, flg, 0.25) {
+				t.Fatalf("sampler and rate disagree on %x with flag %x", tid, flg)
+			}
+			if keep {
+				sampled++
+			}
+		}
+		if flg == 0 && (sampled < 2000 || sampled > 3000) {
+			t.Errorf("sampled %d of 10000 sequential trace ids", sampled)
+		}
+	}
+}
+
+func TestCreateRootRandomFlag(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		random bool
+	}{
+		{"default", nil, true},
+		{"crypto", []Option{WithCryptoRandom()}, true},
+		{"sequential", []Option{UseRandomizer(&SequentialRandom{})}, false},
+		{"func", []Option{UseRandomizer(RandomFunc(func([]byte) {}))}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trc, err := NewTraceCore([]sdktrace.SpanExporter{}, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer trc.Close()
+			if _, flg := trc.CreateRoot(); IsRandomTraceID(flg) != tt.random {
+				t.Errorf("got random flag %v, want %v", IsRandomTraceID(flg), tt.random)
+			}
+		})
+	}
+}
+
+func TestTraceIDSamplingValueMatchesOTel(t *testing.T) {
+	fraction := 0.3
+	otel := sdktrace.TraceIDRatioBased(fraction)
+	bound := uint64(fraction * (1 << 63))
+
+	r := cryptoRandom{}
+	for i := 0; i < 1000; i++ {
+		var tid [16]byte
+		r.Fill(tid[:])
+		res := otel.ShouldSample(sdktrace.SamplingParameters{TraceID: tid})
+		want := res.Decision == sdktrace.RecordAndSample
+		if got := TraceIDSamplingValue(tid) < bound; got != want {
+			t.Fatalf("got %v for %x, open telemetry decided %v", got, tid, want)
+		}
+	}
+}
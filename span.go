@@ -0,0 +1,382 @@
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Soreing/motel"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SamplingPriorityKey is the conventional attribute key used by some backends
+// to decide whether a trace should be retained.
+const SamplingPriorityKey = attribute.Key("sampling.priority")
+
+// RefTypeKey is the attribute key of the type of the relationship of a link,
+// as used by the OpenTracing compatibility of open telemetry.
+const RefTypeKey = attribute.Key("opentracing.ref_type")
+
+// FollowsFromRefType is the value of RefTypeKey for follows-from links.
+const FollowsFromRefType = "follows_from"
+
+// SpanBuilder collects the details of a span while the operation it measures
+// is in progress and dispatches the span when the operation ends. A builder
+// is not safe for concurrent use, except for adding events.
+type SpanBuilder struct {
+	core     *TraceCore
+	name     string
+	kind     trace.SpanKind
+	resource *resource.Resource
+	info     *TraceInfo
+	flag     byte
+	state    string
+	attribs  []attribute.KeyValue
+	evMtx    sync.Mutex
+	events   []sdktrace.Event
+	links    []sdktrace.Link
+	start    time.Time
+	forced   bool
+	ended    bool
+}
+
+// NewSpan starts a span with a name for an operation identified by the trace
+// info. The span is dispatched when it ends, if the flag has the sampled bit.
+func (trc *TraceCore) NewSpan(
+	name string,
+	inf *TraceInfo,
+	flg byte,
+) *SpanBuilder {
+	return &SpanBuilder{
+		core:     trc,
+		name:     name,
+		kind:     trace.SpanKindInternal,
+		resource: trc.resource,
+		info:     inf,
+		flag:     flg,
+		state:    inf.state,
+		start:    trc.clock.Now(),
+		forced:   isForceKept(inf.state),
+	}
+}
+
+// StartSpan starts a span with a name as a child of the span whose trace info
+// is stored in the context, or as the root of a new trace if there is none.
+// The returned context carries the trace info of the new span.
+func (trc *TraceCore) StartSpan(
+	ctx context.Context,
+	name string,
+) (context.Context, *SpanBuilder) {
+	inf, flg := trc.startInfo(ctx)
+	return ContextWithTraceInfo(ctx, inf, flg), trc.NewSpan(name, inf, flg)
+}
+
+// Span starts a span like StartSpan and returns a function that ends it
+// successfully, which is meant to be deferred.
+//
+//	ctx, end := trc.Span(ctx, "name")
+//	defer end()
+//
+// Errors of ending the span are reported to the error handler.
+func (trc *TraceCore) Span(
+	ctx context.Context,
+	name string,
+) (context.Context, func()) {
+	ctx, b := trc.StartSpan(ctx, name)
+	end := b.endFunc()
+	return ctx, func() { end(nil) }
+}
+
+// SpanErr works like Span, but the returned function takes the error of the
+// operation, and the span fails if the error is not nil.
+func (trc *TraceCore) SpanErr(
+	ctx context.Context,
+	name string,
+) (context.Context, func(err error)) {
+	ctx, b := trc.StartSpan(ctx, name)
+	return ctx, b.endFunc()
+}
+
+// endFunc returns a function that ends the span with the outcome of an error
+// and reports errors to the error handler. The error message is added to the
+// failed spans.
+func (b *SpanBuilder) endFunc() func(err error) {
+	return func(err error) {
+		if err != nil {
+			b.SetAttributes(semconv.ExceptionMessageKey.String(err.Error()))
+		}
+		if err := b.End(err == nil); err != nil {
+			b.core.onError(err)
+		}
+	}
+}
+
+// startInfo creates the trace info of a span started from a context.
+func (trc *TraceCore) startInfo(ctx context.Context) (*TraceInfo, byte) {
+	if parent, flg := TraceInfoFromContext(ctx); parent != nil {
+		return trc.CreateChild(parent), flg
+	}
+	return trc.CreateRoot()
+}
+
+// NewFollowsFromSpan starts a span with a name as the root of a new trace,
+// which follows from the span of the trace info instead of being its child,
+// such as for asynchronous work that the origin does not wait for. The span
+// inherits the sampling decision of the origin rather than asking the sampler,
+// so that the work of a sampled trace is not lost. The random trace id flag is
+// set like for the roots of CreateRoot, since the trace id is new.
+func (trc *TraceCore) NewFollowsFromSpan(
+	name string,
+	origin *TraceInfo,
+	flg byte,
+) *SpanBuilder {
+	inf := NewRootTraceInfo(trc.CreateTraceId(), trc.CreateSpanId())
+	root := flg&^FlagRandom | trc.rootFlags()
+	return trc.NewSpan(name, inf, root).FollowsFrom(origin, flg)
+}
+
+// TraceInfo returns the trace info of the span.
+func (b *SpanBuilder) TraceInfo() *TraceInfo {
+	return b.info
+}
+
+// Flag returns the trace flags of the span.
+func (b *SpanBuilder) Flag() byte {
+	return b.flag
+}
+
+// SetKind sets the kind of the span.
+func (b *SpanBuilder) SetKind(kind trace.SpanKind) *SpanBuilder {
+	b.kind = kind
+	return b
+}
+
+// SetResource sets the resource of the span instead of the resource of the
+// trace service or tracer, such as for spans that are reconstructed on behalf
+// of other services. Exporters group spans by their resources.
+func (b *SpanBuilder) SetResource(res *resource.Resource) *SpanBuilder {
+	b.resource = res
+	return b
+}
+
+// SetAttribute adds an attribute to the span.
+func (b *SpanBuilder) SetAttribute(
+	key attribute.Key,
+	value attribute.Value,
+) *SpanBuilder {
+	b.attribs = append(b.attribs, attribute.KeyValue{Key: key, Value: value})
+	return b
+}
+
+// SetAttributes adds attributes to the span.
+func (b *SpanBuilder) SetAttributes(attrs ...attribute.KeyValue) *SpanBuilder {
+	b.attribs = append(b.attribs, attrs...)
+	return b
+}
+
+// AddEvent records an event with a name and attributes at the current time
+// on the span. Events can be added from multiple goroutines concurrently.
+func (b *SpanBuilder) AddEvent(
+	name string,
+	attrs ...attribute.KeyValue,
+) *SpanBuilder {
+	now := b.core.clock.Now()
+	ev := sdktrace.Event{Name: name, Attributes: attrs, Time: now}
+	b.evMtx.Lock()
+	b.events = append(b.events, ev)
+	b.evMtx.Unlock()
+	return b
+}
+
+// AddLink links the span to the span of the trace info, such as to a span of
+// another trace that the operation relates to.
+func (b *SpanBuilder) AddLink(
+	inf *TraceInfo,
+	flg byte,
+	attrs ...attribute.KeyValue,
+) *SpanBuilder {
+	b.links = append(b.links, sdktrace.Link{
+		SpanContext: inf.ToOTelSpanContext(flg),
+		Attributes:  attrs,
+	})
+	return b
+}
+
+// FollowsFrom links the span to the span of the trace info with the
+// follows-from relationship of OpenTracing, which marks operations that are
+// caused by the span but that the span does not wait for.
+func (b *SpanBuilder) FollowsFrom(inf *TraceInfo, flg byte) *SpanBuilder {
+	return b.AddLink(inf, flg, RefTypeKey.String(FollowsFromRefType))
+}
+
+// SetTraceState sets the w3c tracestate of the span, which is included in the
+// span context of the dispatched span.
+func (b *SpanBuilder) SetTraceState(ts string) *SpanBuilder {
+	b.state = ts
+	return b
+}
+
+// SetSamplingPriority sets the sampling priority attribute of the span. A
+// positive priority force-keeps the trace.
+func (b *SpanBuilder) SetSamplingPriority(priority int) *SpanBuilder {
+	b.SetAttribute(SamplingPriorityKey, attribute.IntValue(priority))
+	if priority > 0 {
+		b.ForceKeep()
+	}
+	return b
+}
+
+// ForceKeep marks the trace to be kept by setting the sampled flag of the
+// span, and setting KeepTracestateKey in the tracestate of the span and its
+// trace info, so that the decision is propagated to downstream services. The
+// trace info may already be stored in a context and read concurrently, so it
+// is not modified. The span gets a copy with the tracestate instead, which
+// TraceInfo returns, and which can be stored in a context with
+// ContextWithTraceInfo for the children of the span to inherit the decision.
+func (b *SpanBuilder) ForceKeep() *SpanBuilder {
+	b.forced = true
+	b.flag |= FlagSampled
+	b.state = TracestateSet(b.state, KeepTracestateKey, "1")
+	inf := *b.info
+	inf.state = TracestateSet(inf.state, KeepTracestateKey, "1")
+	b.info = &inf
+	return b
+}
+
+// End ends the span and dispatches it if it is sampled. If the sampler of the
+// trace service is a SpanSampler, it decides whether the span is sampled. A
+// sampling rate in the tracestate overrides the decision of the sampler, if
+// the trace service reads one. Spans of force-kept traces are dispatched
+// regardless of these decisions. If the trace service keeps errors, failed
+// spans are dispatched even if they are not sampled. A span can only be ended
+// once.
+func (b *SpanBuilder) End(success bool) error {
+	if b.ended {
+		return fmt.Errorf("span already ended")
+	}
+	b.ended = true
+
+	if ss, ok := b.core.sampler.(SpanSampler); ok {
+		if ss.ShouldSampleSpan(b.info.tid, b.flag, b.name, b.attribs) {
+			b.flag |= FlagSampled
+		} else {
+			b.flag &^= FlagSampled
+		}
+	}
+	if key := b.core.rateKey; key != "" {
+		if rate, ok := tracestateRate(b.state, key, b.core.rateField); ok {
+			if sampleRate(b.info.tid, b.flag, rate) {
+				b.flag |= FlagSampled
+			} else {
+				b.flag &^= FlagSampled
+			}
+		}
+	}
+	if b.forced {
+		b.flag |= FlagSampled
+	}
+	if !IsSampled(b.flag) && !success && b.core.keepErrors {
+		b.flag |= FlagSampled
+	}
+	if b.core.rates != nil {
+		b.core.rates.record(IsSampled(b.flag))
+	}
+	if !IsSampled(b.flag) {
+		return nil
+	}
+
+	span, err := b.build(success, b.core.clock.Now())
+	if err != nil {
+		return err
+	}
+	return b.core.DispatchSpan(span)
+}
+
+// build creates the span from the details collected by the builder. Names
+// and attributes with invalid UTF-8 are handled according to the UTF-8 mode
+// of the trace service. An invalid tracestate is left out of the span and
+// reported to the error handler.
+func (b *SpanBuilder) build(
+	success bool,
+	end time.Time,
+) (motel.Span, error) {
+	mode := b.core.utf8Mode
+	name, err := sanitizeName(b.name, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	tid, pid, sid := b.info.GetIds()
+	span := motel.CreateSpan(
+		name, b.kind, b.resource,
+		tid, pid, sid, b.flag,
+		success, b.start, end,
+	)
+	for _, kv := range b.attribs {
+		if kv, ok := sanitizeAttribute(kv, mode); ok {
+			span.WithAttribute(kv.Key, kv.Value)
+		}
+	}
+	if key := b.core.parentKey; key != "" && pid != [8]byte{} {
+		span.WithAttribute(key, attribute.StringValue(hex.EncodeToString(pid[:])))
+	}
+
+	b.evMtx.Lock()
+	events := append([]sdktrace.Event{}, b.events...)
+	b.evMtx.Unlock()
+	if len(events) > 0 || len(b.links) > 0 {
+		span = &detailSpan{Span: span, events: events, links: b.links}
+	}
+
+	if b.state != "" {
+		ts, err := trace.ParseTraceState(b.state)
+		if err != nil {
+			// The span is dispatched without the tracestate rather than
+			// being lost because of it.
+			b.core.onError(fmt.Errorf("invalid trace state: %w", err))
+			return span, nil
+		}
+		return &stateSpan{Span: span, state: ts}, nil
+	}
+	return span, nil
+}
+
+// stateSpan is a span with a tracestate in its span context.
+type stateSpan struct {
+	motel.Span
+	state trace.TraceState
+}
+
+// SpanContext returns the span context of the span with the tracestate.
+func (s *stateSpan) SpanContext() trace.SpanContext {
+	return s.Span.SpanContext().WithTraceState(s.state)
+}
+
+// Parent returns the span context of the parent with the tracestate.
+func (s *stateSpan) Parent() trace.SpanContext {
+	return s.Span.Parent().WithTraceState(s.state)
+}
+
+// detailSpan is a span with events and links.
+type detailSpan struct {
+	motel.Span
+	events []sdktrace.Event
+	links  []sdktrace.Link
+}
+
+// Events returns the events of the span.
+func (s *detailSpan) Events() []sdktrace.Event {
+	return s.events
+}
+
+// Links returns the links of the span.
+func (s *detailSpan) Links() []sdktrace.Link {
+	return s.links
+}
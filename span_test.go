@@ -0,0 +1,170 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// dropSampler drops every trace and span.
+type dropSampler struct{}
+
+func (dropSampler) ShouldSample(tid [16]byte, flg byte) bool {
+	return false
+}
+
+func (dropSampler) ShouldSampleSpan(
+	tid [16]byte,
+	flg byte,
+	name string,
+	attrs []attribute.KeyValue,
+) bool {
+	return false
+}
+
+func TestForceKeepOverridesSampling(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []Option
+		state string
+		keep  func(b *SpanBuilder)
+	}{{
+		name: "span sampler with force keep",
+		opts: []Option{WithSampler(dropSampler{})},
+		keep: func(b *SpanBuilder) { b.ForceKeep() },
+	}, {
+		name: "span sampler with sampling priority",
+		opts: []Option{WithSampler(dropSampler{})},
+		keep: func(b *SpanBuilder) { b.SetSamplingPriority(2) },
+	}, {
+		name:  "tracestate rate with force keep",
+		opts:  []Option{WithTracestateSampling("rate", "")},
+		state: "rate=0",
+		keep:  func(b *SpanBuilder) { b.ForceKeep() },
+	}, {
+		name:  "span sampler with kept tracestate",
+		opts:  []Option{WithSampler(dropSampler{})},
+		state: KeepTracestateKey + "=1",
+		keep:  func(b *SpanBuilder) {},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := NewInMemoryExporter()
+			opts := append([]Option{WithCryptoRandom()}, tt.opts...)
+			trc, err := NewTraceCore([]sdktrace.SpanExporter{exp}, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			inf, flg := trc.CreateRoot()
+			inf.SetTraceState(tt.state)
+			b := trc.NewSpan("span", inf, flg)
+			tt.keep(b)
+			if err := b.End(true); err != nil {
+				t.Fatal(err)
+			}
+			if err := trc.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if n := len(exp.Spans()); n != 1 {
+				t.Errorf("exported %d spans, want 1", n)
+			}
+		})
+	}
+}
+
+func TestForceKeepDoesNotModifyContextTraceInfo(t *testing.T) {
+	trc, err := NewTraceCore(
+		[]sdktrace.SpanExporter{NewInMemoryExporter()},
+		WithCryptoRandom(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trc.Close()
+
+	ctx, b := trc.StartSpan(context.Background(), "parent")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			trc.StartSpan(ctx, "child")
+		}
+	}()
+	b.ForceKeep()
+	<-done
+
+	if inf, _ := TraceInfoFromContext(ctx); isForceKept(inf.TraceState()) {
+		t.Error("trace info in the context was modified")
+	}
+	if !isForceKept(b.TraceInfo().TraceState()) {
+		t.Error("trace info of the span is not force-kept")
+	}
+
+	ctx = ContextWithTraceInfo(ctx, b.TraceInfo(), b.Flag())
+	if _, child := trc.StartSpan(ctx, "child"); !child.forced {
+		t.Error("child of the stored trace info is not force-kept")
+	}
+}
+
+func TestFollowsFromSpanRandomFlag(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		random bool
+	}{
+		{"crypto", []Option{WithCryptoRandom()}, true},
+		{"sequential", []Option{UseRandomizer(&SequentialRandom{})}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trc, err := NewTraceCore([]sdktrace.SpanExporter{}, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer trc.Close()
+
+			origin := NewRootTraceInfo(
+				TraceIDFromUint64s(1, 2), SpanIDFromUint64(3),
+			)
+			b := trc.NewFollowsFromSpan("span", origin, FlagSampled|FlagRandom)
+			if IsRandomTraceID(b.Flag()) != tt.random || !IsSampled(b.Flag()) {
+				t.Errorf("got flags %02x", b.Flag())
+			}
+		})
+	}
+}
+
+func TestWrapReadCloserReportsEndErrors(t *testing.T) {
+	var errs []error
+	trc, err := NewTraceCore(
+		[]sdktrace.SpanExporter{NewInMemoryExporter()},
+		WithCryptoRandom(),
+		WithErrorHandler(func(err error) { errs = append(errs, err) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := trc.StartSpan(context.Background(), "read")
+	rc := WrapReadCloser(span, io.NopCloser(strings.NewReader("body")))
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := io.ReadAll(rc); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrClosed) {
+		t.Errorf("got errors %v, want %v", errs, ErrClosed)
+	}
+}
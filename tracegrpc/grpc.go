@@ -0,0 +1,42 @@
+// Package tracegrpc propagates trace contexts in gRPC metadata.
+package tracegrpc
+
+import (
+	"github.com/Soreing/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+// ExtractGRPC decodes the traceparent and tracestate entries of the metadata
+// and returns the trace info of the remote span and the trace flags.
+func ExtractGRPC(md metadata.MD) (*trace.TraceInfo, byte, error) {
+	return trace.TraceContextPropagator{}.Extract(mdCarrier(md))
+}
+
+// InjectGRPC sets the traceparent and tracestate entries of the span of the
+// trace info in the metadata, replacing their previous values.
+func InjectGRPC(md metadata.MD, inf *trace.TraceInfo, flg byte) {
+	md.Delete(trace.TracestateHeader)
+	trace.TraceContextPropagator{}.Inject(mdCarrier(md), inf, flg)
+}
+
+// mdCarrier adapts gRPC metadata to a propagation.TextMapCarrier.
+type mdCarrier metadata.MD
+
+func (c mdCarrier) Get(key string) string {
+	if vals := metadata.MD(c).Get(key); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+func (c mdCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c mdCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
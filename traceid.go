@@ -0,0 +1,118 @@
+package trace
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// NormalizeTraceId decodes a trace id of either 16 or 32 hex digits into a
+// 128-bit trace id. A 64-bit trace id is padded with zeros in the high bytes
+// and reported as short, so it can be formatted in the same width again.
+func NormalizeTraceId(id string) (tid [16]byte, short bool, err error) {
+	switch len(id) {
+	case 16:
+		short = true
+		_, err = hex.Decode(tid[8:], []byte(id))
+	case 32:
+		_, err = hex.Decode(tid[:], []byte(id))
+	default:
+		return [16]byte{}, false, ErrInvalidLength
+	}
+	if err != nil || tid == [16]byte{} {
+		return [16]byte{}, false, ErrInvalidTraceId
+	}
+	return tid, short, nil
+}
+
+// NormalizeSpanId decodes a span id of up to 16 hex digits into a 64-bit span
+// id. Shorter span ids, which some b3 and jaeger clients send when the high
+// digits are zero, are padded with zeros on the left.
+func NormalizeSpanId(id string) (sid [8]byte, err error) {
+	if len(id) == 0 || len(id) > 16 {
+		return [8]byte{}, ErrInvalidSpanId
+	}
+	var buf [16]byte
+	n := copy(buf[16-len(id):], id)
+	for i := 0; i < 16-n; i++ {
+		buf[i] = '0'
+	}
+	if _, err := hex.Decode(sid[:], buf[:]); err != nil {
+		return [8]byte{}, ErrInvalidSpanId
+	}
+	if sid == [8]byte{} {
+		return [8]byte{}, ErrInvalidSpanId
+	}
+	return sid, nil
+}
+
+// FormatTraceId encodes a trace id as hex. If short is set and the high bytes
+// of the trace id are zero, it is encoded as 16 hex digits, otherwise as 32.
+func FormatTraceId(tid [16]byte, short bool) string {
+	if short && *(*[8]byte)(tid[:8]) == [8]byte{} {
+		return hex.EncodeToString(tid[8:])
+	}
+	return hex.EncodeToString(tid[:])
+}
+
+// MaxTraceIdPrefix is the length of the longest trace id prefix.
+const MaxTraceIdPrefix = 8
+
+// TraceIdPrefix returns the first n bytes of a trace id, which hold the prefix
+// of trace ids generated with WithTraceIdPrefix. n is limited to
+// MaxTraceIdPrefix.
+func TraceIdPrefix(tid [16]byte, n int) []byte {
+	if n > MaxTraceIdPrefix {
+		n = MaxTraceIdPrefix
+	}
+	if n < 0 {
+		n = 0
+	}
+	return append([]byte{}, tid[:n]...)
+}
+
+// TraceIDFromSeed derives a trace id from a seed, such as a business
+// correlation id, so that the same seed always maps to the same trace id. The
+// trace id is the low 16 bytes of the SHA-256 hash of the seed.
+func TraceIDFromSeed(seed string) (tid [16]byte) {
+	sum := sha256.Sum256([]byte(seed))
+	copy(tid[:], sum[16:])
+	return
+}
+
+// SpanIDFromSeed derives a span id from a seed, such as the id of a message
+// that may be processed more than once, so that processing the same message
+// again produces the same span id. The span id is the low 8 bytes of the
+// SHA-256 hash of the seed.
+func SpanIDFromSeed(seed string) (sid [8]byte) {
+	sum := sha256.Sum256([]byte(seed))
+	copy(sid[:], sum[24:])
+	return
+}
+
+// Ids are converted to and from integers in big-endian byte order, so the
+// first byte of an id is the most significant byte of the integer. This is the
+// same order as the hex encoding of the ids.
+
+// TraceIDFromUint64s creates a trace id from its high and low 64 bits.
+func TraceIDFromUint64s(hi, lo uint64) (tid [16]byte) {
+	binary.BigEndian.PutUint64(tid[:8], hi)
+	binary.BigEndian.PutUint64(tid[8:], lo)
+	return
+}
+
+// TraceIDToUint64s returns the high and low 64 bits of a trace id.
+func TraceIDToUint64s(tid [16]byte) (hi, lo uint64) {
+	return binary.BigEndian.Uint64(tid[:8]), binary.BigEndian.Uint64(tid[8:])
+}
+
+// SpanIDFromUint64 creates a span id from a 64-bit integer.
+func SpanIDFromUint64(v uint64) (sid [8]byte) {
+	binary.BigEndian.PutUint64(sid[:], v)
+	return
+}
+
+// SpanIDToUint64 returns a span id as a 64-bit integer.
+func SpanIDToUint64(sid [8]byte) uint64 {
+	return binary.BigEndian.Uint64(sid[:])
+}
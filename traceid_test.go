@@ -0,0 +1,41 @@
+package trace
+
+import "testing"
+
+func TestTraceIDUint64sLayout(t *testing.T) {
+	tid := TraceIDFromUint64s(0x0102030405060708, 0x090a0b0c0d0e0f10)
+	want := [16]byte{
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+		0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10,
+	}
+	if tid != want {
+		t.Fatalf("got %x, want %x", tid, want)
+	}
+	if s := FormatTraceId(tid, false); s != "0102030405060708090a0b0c0d0e0f10" {
+		t.Errorf("got hex %s", s)
+	}
+
+	hi, lo := TraceIDToUint64s(tid)
+	if hi != 0x0102030405060708 || lo != 0x090a0b0c0d0e0f10 {
+		t.Errorf("got %x and %x", hi, lo)
+	}
+}
+
+func TestSpanIDUint64Layout(t *testing.T) {
+	sid := SpanIDFromUint64(0x0102030405060708)
+	want := [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	if sid != want {
+		t.Fatalf("got %x, want %x", sid, want)
+	}
+	if v := SpanIDToUint64(sid); v != 0x0102030405060708 {
+		t.Errorf("got %x", v)
+	}
+
+	norm, err := NormalizeSpanId("102030405060708")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := SpanIDToUint64(norm); v != 0x0102030405060708 {
+		t.Errorf("got %x from the hex span id", v)
+	}
+}
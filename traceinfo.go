@@ -1,12 +1,22 @@
 package trace
 
-import "encoding/hex"
+import (
+	"encoding/hex"
+
+	"github.com/Soreing/motel"
+
+	"go.opentelemetry.io/otel/trace"
+)
 
 // TraceInfo is a single data type containing trace id, parent id and span id.
 type TraceInfo struct {
 	tid [16]byte
 	pid [8]byte
 	sid [8]byte
+
+	remote bool
+	short  bool
+	state  string
 }
 
 // NewTraceInfo creates a TraceInfo object from trace id, parent id and span id.
@@ -22,11 +32,85 @@ func NewTraceInfo(
 	return inf
 }
 
+// TraceInfoFromSpan creates a TraceInfo object from the trace id, parent id
+// and span id of a span.
+func TraceInfoFromSpan(span motel.Span) *TraceInfo {
+	sc, pc := span.SpanContext(), span.Parent()
+	return NewTraceInfo(sc.TraceID(), pc.SpanID(), sc.SpanID())
+}
+
+// NewRootTraceInfo creates a TraceInfo object for a root span, which has no
+// parent, from trace id and span id.
+func NewRootTraceInfo(tid [16]byte, sid [8]byte) *TraceInfo {
+	return NewTraceInfo(tid, [8]byte{}, sid)
+}
+
+// IsRoot reports whether the trace info is of a root span, which has no
+// parent. Remote trace infos are not roots, as their parents are unknown.
+func (inf *TraceInfo) IsRoot() bool {
+	return inf.pid == [8]byte{} && !inf.remote
+}
+
+// newRemoteTraceInfo creates a TraceInfo object for a span that was extracted
+// from a remote process, identified by the trace id and span id.
+func newRemoteTraceInfo(tid [16]byte, sid [8]byte) *TraceInfo {
+	inf := NewRootTraceInfo(tid, sid)
+	inf.remote = true
+	return inf
+}
+
+// IsRemote reports whether the trace info was extracted from a remote
+// process rather than created locally.
+func (inf *TraceInfo) IsRemote() bool {
+	return inf.remote
+}
+
+// ToOTelSpanContext converts the trace info into an open telemetry span
+// context with the trace flags.
+func (inf *TraceInfo) ToOTelSpanContext(flg byte) trace.SpanContext {
+	ts, _ := trace.ParseTraceState(inf.state)
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    inf.tid,
+		SpanID:     inf.sid,
+		TraceFlags: trace.TraceFlags(flg),
+		TraceState: ts,
+		Remote:     inf.remote,
+	})
+}
+
+// TraceState returns the w3c tracestate of the trace info.
+func (inf *TraceInfo) TraceState() string {
+	return inf.state
+}
+
+// SetTraceState sets the w3c tracestate of the trace info, which is passed on
+// to its children and propagated with it.
+func (inf *TraceInfo) SetTraceState(ts string) {
+	inf.state = ts
+}
+
 // GetIds returns the trace id, parent id and span id as byte arrays.
 func (inf *TraceInfo) GetIds() ([16]byte, [8]byte, [8]byte) {
 	return inf.tid, inf.pid, inf.sid
 }
 
+// IsValid reports whether the trace id and span id are not all zeros.
+func (inf *TraceInfo) IsValid() bool {
+	return inf.tid != [16]byte{} && inf.sid != [8]byte{}
+}
+
+// GetValidIds returns the trace id, parent id and span id like GetIds, or an
+// error if the trace id or span id is all zeros.
+func (inf *TraceInfo) GetValidIds() ([16]byte, [8]byte, [8]byte, error) {
+	if inf.tid == [16]byte{} {
+		return inf.tid, inf.pid, inf.sid, ErrInvalidTraceId
+	}
+	if inf.sid == [8]byte{} {
+		return inf.tid, inf.pid, inf.sid, ErrInvalidSpanId
+	}
+	return inf.tid, inf.pid, inf.sid, nil
+}
+
 // GetStringIds returns the trace id, parent id and span id as strings.
 func (inf *TraceInfo) GetStringIds() (string, string, string) {
 	tid := hex.EncodeToString(inf.tid[:])
@@ -34,3 +118,73 @@ func (inf *TraceInfo) GetStringIds() (string, string, string) {
 	sid := hex.EncodeToString(inf.sid[:])
 	return tid, pid, sid
 }
+
+// NewChild creates a TraceInfo object for a child span with the span id. The
+// child has the same trace id and its parent id is the span id of inf.
+func (inf *TraceInfo) NewChild(sid [8]byte) *TraceInfo {
+	child := NewTraceInfo(inf.tid, inf.sid, sid)
+	child.short = inf.short
+	child.state = inf.state
+	return child
+}
+
+// Hops returns the value of the hop counter in the tracestate of the trace
+// info, or zero if it has none. See HopsTracestateKey.
+func (inf *TraceInfo) Hops() int {
+	return tracestateHops(inf.state)
+}
+
+// Is64BitTraceId reports whether the trace id originated as a 64-bit trace
+// id and is padded to 128 bits.
+func (inf *TraceInfo) Is64BitTraceId() bool {
+	return inf.short
+}
+
+// Traceparent creates a w3c traceparent header that identifies the span of
+// the trace info as the parent.
+func (inf *TraceInfo) Traceparent(flg byte) string {
+	return EncodeTraceparent(0, inf.tid, inf.sid, flg)
+}
+
+// TraceIDUUID returns the trace id formatted as a UUID string, with hex digit
+// groups of 8-4-4-4-12 separated by dashes.
+func (inf *TraceInfo) TraceIDUUID() string {
+	buf := make([]byte, 36)
+	buf[8], buf[13], buf[18], buf[23] = '-', '-', '-', '-'
+	hex.Encode(buf[0:8], inf.tid[0:4])
+	hex.Encode(buf[9:13], inf.tid[4:6])
+	hex.Encode(buf[14:18], inf.tid[6:8])
+	hex.Encode(buf[19:23], inf.tid[8:10])
+	hex.Encode(buf[24:], inf.tid[10:])
+	return string(buf)
+}
+
+// IsChildOf reports whether the trace info is a child of the parent, which is
+// when both have the same trace id and the parent id of the child is the span
+// id of the parent.
+func (inf *TraceInfo) IsChildOf(parent *TraceInfo) bool {
+	return parent != nil && inf.tid == parent.tid && inf.pid == parent.sid
+}
+
+// MarshalBinary encodes the trace info as 32 bytes of the trace id, parent id
+// and span id. The tracestate and other details are not encoded.
+func (inf *TraceInfo) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 32)
+	copy(data[:16], inf.tid[:])
+	copy(data[16:24], inf.pid[:])
+	copy(data[24:], inf.sid[:])
+	return data, nil
+}
+
+// UnmarshalBinary decodes the trace info from 32 bytes of the trace id,
+// parent id and span id.
+func (inf *TraceInfo) UnmarshalBinary(data []byte) error {
+	if len(data) != 32 {
+		return ErrInvalidLength
+	}
+	*inf = TraceInfo{}
+	copy(inf.tid[:], data[:16])
+	copy(inf.pid[:], data[16:24])
+	copy(inf.sid[:], data[24:])
+	return nil
+}
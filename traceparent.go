@@ -0,0 +1,153 @@
+package trace
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Traceparent is a decoded w3c traceparent header.
+type Traceparent struct {
+	Version  byte
+	TraceId  [16]byte
+	ParentId [8]byte
+	Flags    byte
+}
+
+// ParseTraceparent parses and validates a w3c traceparent header.
+func ParseTraceparent(header string) (Traceparent, error) {
+	ver, tid, pid, flg, err := DecodeTraceparent(header)
+	if err != nil {
+		return Traceparent{}, err
+	}
+	return Traceparent{
+		Version:  ver,
+		TraceId:  tid,
+		ParentId: pid,
+		Flags:    flg,
+	}, nil
+}
+
+// IsSampled reports whether the sampled flag is set.
+func (tp Traceparent) IsSampled() bool {
+	return IsSampled(tp.Flags)
+}
+
+// IsRandomTraceID reports whether the random trace id flag is set.
+func (tp Traceparent) IsRandomTraceID() bool {
+	return IsRandomTraceID(tp.Flags)
+}
+
+// String encodes the traceparent as a header.
+func (tp Traceparent) String() string {
+	return EncodeTraceparent(tp.Version, tp.TraceId, tp.ParentId, tp.Flags)
+}
+
+// EncodeTraceparentHex creates a w3c traceparent header from the version,
+// trace id, parent id and flag given as hex strings. It returns an error if
+// any of them is not valid hex of the right length.
+func EncodeTraceparentHex(
+	verHex string,
+	tidHex string,
+	pidHex string,
+	flgHex string,
+) (string, error) {
+	var ver, flg [1]byte
+	var tid [16]byte
+	var pid [8]byte
+
+	if len(verHex) != 2 || !decodeHex(ver[:], verHex) {
+		return "", ErrInvalidVersion
+	}
+	if len(tidHex) != 32 || !decodeHex(tid[:], tidHex) {
+		return "", ErrInvalidTraceId
+	}
+	if len(pidHex) != 16 || !decodeHex(pid[:], pidHex) {
+		return "", ErrInvalidParentId
+	}
+	if len(flgHex) != 2 || !decodeHex(flg[:], flgHex) {
+		return "", ErrInvalidFlag
+	}
+	return EncodeTraceparent(ver[0], tid, pid, flg[0]), nil
+}
+
+// decodeHex decodes the hex string into dst and reports whether it was valid.
+func decodeHex(dst []byte, src string) bool {
+	_, err := hex.Decode(dst, []byte(src))
+	return err == nil
+}
+
+// TraceIDFromTraceparent returns the trace id of a w3c traceparent header as
+// a string without decoding the rest of the header. Only the length, the
+// position of the trace id and its hex digits are validated.
+func TraceIDFromTraceparent(header string) (string, error) {
+	if len(header) < 55 {
+		return "", ErrInvalidLength
+	}
+	if header[2] != '-' || header[35] != '-' {
+		return "", ErrInvalidFormat
+	}
+	tid := header[3:35]
+	for i := 0; i < len(tid); i++ {
+		if c := tid[i]; (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return "", ErrInvalidTraceId
+		}
+	}
+	return tid, nil
+}
+
+// SameTrace reports whether two w3c traceparent headers belong to the same
+// trace by comparing their trace ids. Only the length and the positions of
+// the dashes around the trace id are validated.
+func SameTrace(a, b string) (bool, error) {
+	for _, header := range [2]string{a, b} {
+		if len(header) < 55 {
+			return false, ErrInvalidLength
+		}
+		if header[2] != '-' || header[35] != '-' {
+			return false, ErrInvalidFormat
+		}
+	}
+	return a[3:35] == b[3:35], nil
+}
+
+// RoundTrip decodes a traceparent and tracestate, encodes them again and
+// checks that the result matches the input. The documented normalizations
+// are that fields after the flag of versions after 00 are dropped, and that
+// whitespace and empty members are removed from the tracestate. It returns
+// the encoded traceparent and tracestate, or an error if they are invalid or
+// do not match.
+func RoundTrip(traceparent, tracestate string) (string, string, error) {
+	tp, err := ParseTraceparent(traceparent)
+	if err != nil {
+		return "", "", err
+	}
+	header := tp.String()
+	if header != traceparent[:55] {
+		return "", "", fmt.Errorf("traceparent mismatch")
+	}
+
+	normalized := normalizeTracestate(tracestate)
+	ts, err := trace.ParseTraceState(normalized)
+	if err != nil {
+		return "", "", err
+	}
+	state := ts.String()
+	if state != normalized {
+		return "", "", fmt.Errorf("tracestate mismatch")
+	}
+	return header, state, nil
+}
+
+// normalizeTracestate removes whitespace and empty members from a tracestate.
+func normalizeTracestate(ts string) string {
+	members := []string{}
+	for _, member := range strings.Split(ts, ",") {
+		if member = strings.TrimSpace(member); member != "" {
+			members = append(members, member)
+		}
+	}
+	return strings.Join(members, ",")
+}
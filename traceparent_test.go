@@ -0,0 +1,155 @@
+package trace
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// The cases are taken from the test suite of the w3c trace context
+// specification.
+func TestRoundTrip(t *testing.T) {
+	const tid, pid = "0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331"
+
+	many := make([]string, 33)
+	for i := range many {
+		many[i] = "k" + strings.Repeat("x", i) + "=1"
+	}
+
+	tests := []struct {
+		name        string
+		traceparent string
+		tracestate  string
+		wantParent  string
+		wantState   string
+		wantErr     bool
+	}{{
+		name:        "sampled",
+		traceparent: "00-" + tid + "-" + pid + "-01",
+		wantParent:  "00-" + tid + "-" + pid + "-01",
+	}, {
+		name:        "not sampled",
+		traceparent: "00-" + tid + "-" + pid + "-00",
+		wantParent:  "00-" + tid + "-" + pid + "-00",
+	}, {
+		name:        "future version with more fields",
+		traceparent: "cc-" + tid + "-" + pid + "-01-what-the-future-will-be-like",
+		wantParent:  "cc-" + tid + "-" + pid + "-01",
+	}, {
+		name:        "version ff",
+		traceparent: "ff-" + tid + "-" + pid + "-01",
+		wantErr:     true,
+	}, {
+		name:        "version 00 with more fields",
+		traceparent: "00-" + tid + "-" + pid + "-01-extra",
+		wantErr:     true,
+	}, {
+		name:        "zero trace id",
+		traceparent: "00-00000000000000000000000000000000-" + pid + "-01",
+		wantErr:     true,
+	}, {
+		name:        "zero parent id",
+		traceparent: "00-" + tid + "-0000000000000000-01",
+		wantErr:     true,
+	}, {
+		name:        "upper case hex",
+		traceparent: "00-" + strings.ToUpper(tid) + "-" + pid + "-01",
+		wantErr:     true,
+	}, {
+		name:        "short trace id",
+		traceparent: "00-" + tid[1:] + "-" + pid + "-01",
+		wantErr:     true,
+	}, {
+		name:        "tracestate",
+		traceparent: "00-" + tid + "-" + pid + "-01",
+		tracestate:  "foo=1,bar@baz=2",
+		wantParent:  "00-" + tid + "-" + pid + "-01",
+		wantState:   "foo=1,bar@baz=2",
+	}, {
+		name:        "tracestate with whitespace and empty members",
+		traceparent: "00-" + tid + "-" + pid + "-01",
+		tracestate:  "foo=1 ,, \tbar=2",
+		wantParent:  "00-" + tid + "-" + pid + "-01",
+		wantState:   "foo=1,bar=2",
+	}, {
+		name:        "tracestate with upper case key",
+		traceparent: "00-" + tid + "-" + pid + "-01",
+		tracestate:  "FOO=1",
+		wantErr:     true,
+	}, {
+		name:        "tracestate with duplicate keys",
+		traceparent: "00-" + tid + "-" + pid + "-01",
+		tracestate:  "foo=1,foo=2",
+		wantErr:     true,
+	}, {
+		name:        "tracestate with too many members",
+		traceparent: "00-" + tid + "-" + pid + "-01",
+		tracestate:  strings.Join(many, ","),
+		wantErr:     true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent, state, err := RoundTrip(tt.traceparent, tt.tracestate)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %q and %q, want an error", parent, state)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parent != tt.wantParent || state != tt.wantState {
+				t.Errorf("got %q and %q, want %q and %q",
+					parent, state, tt.wantParent, tt.wantState)
+			}
+		})
+	}
+}
+
+// invalidTraceparents are rejected for each of the reasons DecodeTraceparent
+// reports.
+var invalidTraceparents = []struct {
+	header string
+	err    error
+}{
+	{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331", ErrInvalidLength},
+	{"00_0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", ErrInvalidFormat},
+	{"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", ErrInvalidVersion},
+	{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-0g", ErrInvalidFlag},
+	{"00-00000000000000000000000000000000-b7ad6b7169203331-01", ErrInvalidTraceId},
+	{"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01", ErrInvalidParentId},
+}
+
+func TestDecodeTraceparentRejectsWithoutAllocating(t *testing.T) {
+	for _, tt := range invalidTraceparents {
+		_, _, _, _, err := DecodeTraceparent(tt.header)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.header, err, tt.err)
+		}
+		allocs := testing.AllocsPerRun(100, func() {
+			DecodeTraceparent(tt.header)
+		})
+		if allocs != 0 {
+			t.Errorf("%s: got %v allocations, want 0", tt.header, allocs)
+		}
+	}
+}
+
+func BenchmarkDecodeTraceparentReject(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tt := invalidTraceparents[i%len(invalidTraceparents)]
+		DecodeTraceparent(tt.header)
+	}
+}
+
+func BenchmarkEncodeTraceparent(b *testing.B) {
+	tid := TraceIDFromUint64s(0x0af7651916cd43dd, 0x8448eb211c80319c)
+	pid := SpanIDFromUint64(0xb7ad6b7169203331)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		EncodeTraceparent(0, tid, pid, FlagSampled)
+	}
+}
@@ -0,0 +1,78 @@
+package trace
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// Tracer starts spans for a component with a bound service name and default
+// attributes, while sharing the exporters of the trace service.
+type Tracer struct {
+	core     *TraceCore
+	resource *resource.Resource
+	attribs  []attribute.KeyValue
+}
+
+// Tracer creates a tracer whose spans have the service name in their resource
+// and the default attributes. The resource of the trace service, if any, is
+// merged with the service name.
+func (trc *TraceCore) Tracer(
+	serviceName string,
+	defaultAttrs ...attribute.KeyValue,
+) *Tracer {
+	res := resource.NewSchemaless(trc.serviceAttributes(serviceName)...)
+	if trc.resource != nil {
+		if merged, err := resource.Merge(trc.resource, res); err == nil {
+			res = merged
+		} else {
+			trc.onError(err)
+		}
+	}
+
+	return &Tracer{
+		core:     trc,
+		resource: res,
+		attribs:  append([]attribute.KeyValue{}, defaultAttrs...),
+	}
+}
+
+// NewSpan starts a span like TraceCore.NewSpan, with the resource and the
+// default attributes of the tracer.
+func (t *Tracer) NewSpan(name string, inf *TraceInfo, flg byte) *SpanBuilder {
+	b := t.core.NewSpan(name, inf, flg).SetAttributes(t.attribs...)
+	b.resource = t.resource
+	return b
+}
+
+// StartSpan starts a span like TraceCore.StartSpan, with the resource and the
+// default attributes of the tracer.
+func (t *Tracer) StartSpan(
+	ctx context.Context,
+	name string,
+) (context.Context, *SpanBuilder) {
+	inf, flg := t.core.startInfo(ctx)
+	return ContextWithTraceInfo(ctx, inf, flg), t.NewSpan(name, inf, flg)
+}
+
+// Span starts a span like TraceCore.Span, with the resource and the default
+// attributes of the tracer.
+func (t *Tracer) Span(
+	ctx context.Context,
+	name string,
+) (context.Context, func()) {
+	ctx, b := t.StartSpan(ctx, name)
+	end := b.endFunc()
+	return ctx, func() { end(nil) }
+}
+
+// SpanErr starts a span like TraceCore.SpanErr, with the resource and the
+// default attributes of the tracer.
+func (t *Tracer) SpanErr(
+	ctx context.Context,
+	name string,
+) (context.Context, func(err error)) {
+	ctx, b := t.StartSpan(ctx, name)
+	return ctx, b.endFunc()
+}
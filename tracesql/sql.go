@@ -0,0 +1,367 @@
+// Package tracesql records spans for the queries of database/sql drivers.
+package tracesql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+
+	"github.com/Soreing/trace"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Span names of the traced operations.
+const (
+	QuerySpanName = "sql.query"
+	ExecSpanName  = "sql.exec"
+)
+
+// Configuration is a collection of options that apply to the traced driver.
+type Configuration struct {
+	redact  func(string) string
+	attribs []attribute.KeyValue
+	onError func(error)
+}
+
+// newConfiguration creates default configs and applies options
+func newConfiguration(opts []Option) *Configuration {
+	cfg := &Configuration{
+		onError: func(error) {},
+	}
+	for _, opt := range opts {
+		opt.Configure(cfg)
+	}
+	return cfg
+}
+
+// Option defines objects that can change a Configuration.
+type Option interface {
+	Configure(c *Configuration)
+}
+
+// WithStatementRedaction creates an option for changing the statements before
+// they are added to the spans, such as for removing sensitive literals. If the
+// function returns an empty string, the statement is not added.
+func WithStatementRedaction(fn func(string) string) Option {
+	return &redactOption{
+		fn: fn,
+	}
+}
+
+type redactOption struct {
+	fn func(string) string
+}
+
+func (o *redactOption) Configure(c *Configuration) {
+	c.redact = o.fn
+}
+
+// WithAttributes creates an option for adding attributes to every span, such
+// as semconv.DBSystemPostgreSQL or the name of the database.
+func WithAttributes(attrs ...attribute.KeyValue) Option {
+	return &attributesOption{
+		attribs: attrs,
+	}
+}
+
+type attributesOption struct {
+	attribs []attribute.KeyValue
+}
+
+func (o *attributesOption) Configure(c *Configuration) {
+	c.attribs = append(c.attribs, o.attribs...)
+}
+
+// WithErrorHandler creates an option for handling the errors of ending the
+// spans of the operations, such as when the trace service is closed. The
+// errors of the operations themselves are returned to the caller as usual.
+func WithErrorHandler(handler func(error)) Option {
+	return &errorHandlerOption{
+		handler: handler,
+	}
+}
+
+type errorHandlerOption struct {
+	handler func(error)
+}
+
+func (o *errorHandlerOption) Configure(c *Configuration) {
+	c.onError = o.handler
+}
+
+// tracer starts the spans of the operations.
+type tracer struct {
+	core *trace.TraceCore
+	cfg  *Configuration
+}
+
+// start starts a client span for an operation with a statement. The span is
+// a child of the span whose trace info is stored in the context.
+func (t *tracer) start(
+	ctx context.Context,
+	name string,
+	query string,
+) *trace.SpanBuilder {
+	_, span := t.core.StartSpan(ctx, name)
+	span.SetKind(oteltrace.SpanKindClient).SetAttributes(t.cfg.attribs...)
+	if t.cfg.redact != nil {
+		query = t.cfg.redact(query)
+	}
+	if query != "" {
+		span.SetAttributes(semconv.DBStatementKey.String(query))
+	}
+	return span
+}
+
+// end ends the span of an operation with the error of the operation, and
+// reports errors of ending the span to the error handler.
+func (t *tracer) end(span *trace.SpanBuilder, err error) {
+	if err != nil {
+		span.SetAttributes(semconv.ExceptionMessageKey.String(err.Error()))
+	}
+	if err := span.End(err == nil); err != nil {
+		t.cfg.onError(err)
+	}
+}
+
+// WrapDriver returns a driver that records spans for the queries of the
+// driver, which can be registered with sql.Register.
+func WrapDriver(
+	trc *trace.TraceCore,
+	d driver.Driver,
+	opts ...Option,
+) driver.Driver {
+	return &tracedDriver{
+		Driver: d,
+		t:      &tracer{core: trc, cfg: newConfiguration(opts)},
+	}
+}
+
+// NewConnector returns a connector that records spans for the queries of the
+// connections of the connector, which can be used with sql.OpenDB.
+func NewConnector(
+	trc *trace.TraceCore,
+	c driver.Connector,
+	opts ...Option,
+) driver.Connector {
+	return &tracedConnector{
+		Connector: c,
+		t:         &tracer{core: trc, cfg: newConfiguration(opts)},
+	}
+}
+
+type tracedDriver struct {
+	driver.Driver
+	t *tracer
+}
+
+func (d *tracedDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: c, t: d.t}, nil
+}
+
+func (d *tracedDriver) OpenConnector(name string) (driver.Connector, error) {
+	if dc, ok := d.Driver.(driver.DriverContext); ok {
+		c, err := dc.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return &tracedConnector{Connector: c, t: d.t}, nil
+	}
+	return &dsnConnector{name: name, d: d}, nil
+}
+
+type tracedConnector struct {
+	driver.Connector
+	t *tracer
+}
+
+func (c *tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn, t: c.t}, nil
+}
+
+func (c *tracedConnector) Driver() driver.Driver {
+	return &tracedDriver{Driver: c.Connector.Driver(), t: c.t}
+}
+
+// dsnConnector is a connector for drivers that only open connections by name.
+type dsnConnector struct {
+	name string
+	d    *tracedDriver
+}
+
+func (c *dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.d.Open(c.name)
+}
+
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.d
+}
+
+type tracedConn struct {
+	driver.Conn
+	t *tracer
+}
+
+func (c *tracedConn) PrepareContext(
+	ctx context.Context,
+	query string,
+) (driver.Stmt, error) {
+	var st driver.Stmt
+	var err error
+	if pc, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		st, err = pc.PrepareContext(ctx, query)
+	} else {
+		st, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tracedStmt{Stmt: st, t: c.t, query: query}, nil
+}
+
+func (c *tracedConn) BeginTx(
+	ctx context.Context,
+	opts driver.TxOptions,
+) (driver.Tx, error) {
+	if bc, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return bc.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != 0 || opts.ReadOnly {
+		return nil, errors.New("driver does not support transaction options")
+	}
+	return c.Conn.Begin()
+}
+
+func (c *tracedConn) ExecContext(
+	ctx context.Context,
+	query string,
+	args []driver.NamedValue,
+) (driver.Result, error) {
+	ec, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	span := c.t.start(ctx, ExecSpanName, query)
+	res, err := ec.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.t.end(span, err)
+	}
+	return res, err
+}
+
+func (c *tracedConn) QueryContext(
+	ctx context.Context,
+	query string,
+	args []driver.NamedValue,
+) (driver.Rows, error) {
+	qc, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	span := c.t.start(ctx, QuerySpanName, query)
+	rows, err := qc.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.t.end(span, err)
+	}
+	return rows, err
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *tracedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type tracedStmt struct {
+	driver.Stmt
+	t     *tracer
+	query string
+}
+
+func (s *tracedStmt) ExecContext(
+	ctx context.Context,
+	args []driver.NamedValue,
+) (driver.Result, error) {
+	span := s.t.start(ctx, ExecSpanName, s.query)
+	var res driver.Result
+	var err error
+	if ec, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = ec.ExecContext(ctx, args)
+	} else if vals, verr := namedValues(args); verr != nil {
+		err = verr
+	} else {
+		res, err = s.Stmt.Exec(vals)
+	}
+	s.t.end(span, err)
+	return res, err
+}
+
+func (s *tracedStmt) QueryContext(
+	ctx context.Context,
+	args []driver.NamedValue,
+) (driver.Rows, error) {
+	span := s.t.start(ctx, QuerySpanName, s.query)
+	var rows driver.Rows
+	var err error
+	if qc, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = qc.QueryContext(ctx, args)
+	} else if vals, verr := namedValues(args); verr != nil {
+		err = verr
+	} else {
+		rows, err = s.Stmt.Query(vals)
+	}
+	s.t.end(span, err)
+	return rows, err
+}
+
+func (s *tracedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// namedValues converts the arguments for statements that do not support
+// named arguments.
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	vals := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("driver does not support named arguments")
+		}
+		vals[i] = arg.Value
+	}
+	return vals, nil
+}
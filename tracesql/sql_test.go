@@ -0,0 +1,353 @@
+package tracesql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Soreing/trace"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// errQuery is returned by the fake driver for statements containing "fail".
+var errQuery = errors.New("query failed")
+
+// fakeDriver is a driver whose connections run statements without a database.
+// Statements containing "skip" are rejected by the direct exec and query
+// methods of the connections with driver.ErrSkip, so that they are prepared.
+type fakeDriver struct {
+	prepared int
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{d: d}, nil
+}
+
+type fakeConnector struct {
+	d *fakeDriver
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.d.Open("")
+}
+
+func (c fakeConnector) Driver() driver.Driver {
+	return c.d
+}
+
+type fakeConn struct {
+	d *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.prepared++
+	return &fakeStmt{query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (c *fakeConn) ExecContext(
+	ctx context.Context,
+	query string,
+	args []driver.NamedValue,
+) (driver.Result, error) {
+	if strings.Contains(query, "skip") {
+		return nil, driver.ErrSkip
+	}
+	return result(query)
+}
+
+func (c *fakeConn) QueryContext(
+	ctx context.Context,
+	query string,
+	args []driver.NamedValue,
+) (driver.Rows, error) {
+	if strings.Contains(query, "skip") {
+		return nil, driver.ErrSkip
+	}
+	return rows(query)
+}
+
+type fakeStmt struct {
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return result(s.query)
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return rows(s.query)
+}
+
+func result(query string) (driver.Result, error) {
+	if strings.Contains(query, "fail") {
+		return nil, errQuery
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func rows(query string) (driver.Rows, error) {
+	if strings.Contains(query, "fail") {
+		return nil, errQuery
+	}
+	return fakeRows{}, nil
+}
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string {
+	return []string{}
+}
+
+func (fakeRows) Close() error {
+	return nil
+}
+
+func (fakeRows) Next(dest []driver.Value) error {
+	return io.EOF
+}
+
+// newDB creates a trace service that stores spans in memory and a database of
+// the fake driver traced with the options.
+func newDB(
+	t *testing.T,
+	opts ...Option,
+) (*trace.TraceCore, *trace.InMemoryExporter, *fakeDriver, *sql.DB) {
+	t.Helper()
+	exp := trace.NewInMemoryExporter()
+	trc, err := trace.NewTraceCore(
+		[]sdktrace.SpanExporter{exp},
+		trace.WithCryptoRandom(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &fakeDriver{}
+	db := sql.OpenDB(NewConnector(trc, fakeConnector{d: d}, opts...))
+	t.Cleanup(func() { db.Close() })
+	return trc, exp, d, db
+}
+
+// statement returns the statement attribute of the span.
+func statement(sp sdktrace.ReadOnlySpan) (string, bool) {
+	for _, kv := range sp.Attributes() {
+		if kv.Key == semconv.DBStatementKey {
+			return kv.Value.AsString(), true
+		}
+	}
+	return "", false
+}
+
+func TestSpanPerOperation(t *testing.T) {
+	trc, exp, d, db := newDB(t)
+	ctx := context.Background()
+
+	if _, err := db.ExecContext(ctx, "insert"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.QueryContext(ctx, "select")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exp.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if spans[0].Name() != ExecSpanName || spans[1].Name() != QuerySpanName {
+		t.Errorf("got spans %s and %s", spans[0].Name(), spans[1].Name())
+	}
+	if q, _ := statement(spans[0]); q != "insert" {
+		t.Errorf("got statement %q, want %q", q, "insert")
+	}
+	if d.prepared != 0 {
+		t.Errorf("prepared %d statements, want 0", d.prepared)
+	}
+}
+
+func TestSpansNestUnderContext(t *testing.T) {
+	trc, exp, _, db := newDB(t)
+	ctx, parent := trc.StartSpan(context.Background(), "parent")
+
+	if _, err := db.ExecContext(ctx, "insert"); err != nil {
+		t.Fatal(err)
+	}
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exp.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	tid, _, sid := parent.TraceInfo().GetIds()
+	if spans[0].SpanContext().TraceID() != tid {
+		t.Error("span is not in the trace of the context")
+	}
+	if spans[0].Parent().SpanID() != sid {
+		t.Error("span is not a child of the span of the context")
+	}
+}
+
+func TestStatementRedaction(t *testing.T) {
+	trc, exp, _, db := newDB(t, WithStatementRedaction(func(q string) string {
+		if strings.Contains(q, "secret") {
+			return ""
+		}
+		return strings.ToUpper(q)
+	}))
+	ctx := context.Background()
+
+	for _, q := range []string{"insert", "insert secret"} {
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exp.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if q, _ := statement(spans[0]); q != "INSERT" {
+		t.Errorf("got statement %q, want %q", q, "INSERT")
+	}
+	if q, ok := statement(spans[1]); ok {
+		t.Errorf("got statement %q, want none", q)
+	}
+}
+
+func TestSkipFallsBackToPrepare(t *testing.T) {
+	trc, exp, d, db := newDB(t)
+	ctx := context.Background()
+
+	if _, err := db.ExecContext(ctx, "skip insert"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.QueryContext(ctx, "skip select")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.prepared != 2 {
+		t.Errorf("prepared %d statements, want 2", d.prepared)
+	}
+	spans := exp.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want one per operation", len(spans))
+	}
+	if spans[0].Name() != ExecSpanName || spans[1].Name() != QuerySpanName {
+		t.Errorf("got spans %s and %s", spans[0].Name(), spans[1].Name())
+	}
+}
+
+func TestOperationErrors(t *testing.T) {
+	trc, exp, _, db := newDB(t)
+	ctx := context.Background()
+
+	if _, err := db.ExecContext(ctx, "fail"); !errors.Is(err, errQuery) {
+		t.Fatalf("got %v, want %v", err, errQuery)
+	}
+	if _, err := db.QueryContext(ctx, "skip fail"); !errors.Is(err, errQuery) {
+		t.Fatalf("got %v, want %v", err, errQuery)
+	}
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exp.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	for _, sp := range spans {
+		if sp.Status().Code != codes.Error {
+			t.Errorf("%s: got status %v, want an error", sp.Name(), sp.Status())
+		}
+		found := false
+		for _, kv := range sp.Attributes() {
+			if kv.Key == semconv.ExceptionMessageKey {
+				found = kv.Value.AsString() == errQuery.Error()
+			}
+		}
+		if !found {
+			t.Errorf("%s: error message was not recorded", sp.Name())
+		}
+	}
+}
+
+func TestEndErrorsAreReported(t *testing.T) {
+	var errs []error
+	trc, _, _, db := newDB(t, WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.ExecContext(context.Background(), "insert"); err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], trace.ErrClosed) {
+		t.Errorf("got errors %v, want %v", errs, trace.ErrClosed)
+	}
+}
+
+func TestWrapDriver(t *testing.T) {
+	exp := trace.NewInMemoryExporter()
+	trc, err := trace.NewTraceCore(
+		[]sdktrace.SpanExporter{exp},
+		trace.WithCryptoRandom(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := WrapDriver(trc, &fakeDriver{})
+	connector, err := d.(driver.DriverContext).OpenConnector("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	if _, err := db.ExecContext(context.Background(), "insert"); err != nil {
+		t.Fatal(err)
+	}
+	if err := trc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(exp.Spans()); n != 1 {
+		t.Errorf("got %d spans, want 1", n)
+	}
+}
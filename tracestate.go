@@ -0,0 +1,158 @@
+package trace
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KeepTracestateKey is the tracestate key that marks a trace that must be
+// kept. When a trace is force-kept, the key is set to "1" in its tracestate,
+// and extracting a trace context that has it force-samples the trace. The key
+// is in the multi-tenant tenant@system format, so that it does not collide
+// with the members of other vendors.
+const KeepTracestateKey = "keep@soreing"
+
+// HopsTracestateKey is the tracestate key of the hop counter, which counts the
+// services a trace passed through. With WithMaxHops, the counter is
+// incremented whenever a service continues a trace extracted from a request.
+// Like KeepTracestateKey, it is a multi-tenant key.
+const HopsTracestateKey = "hops@soreing"
+
+// TracestateGet returns the value of the key in a w3c tracestate.
+func TracestateGet(ts string, key string) (string, bool) {
+	for _, member := range strings.Split(ts, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if ok && k == key {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// TracestateSet sets the key to the value in a w3c tracestate. As required by
+// the specification, the updated member is moved to the front.
+func TracestateSet(ts string, key string, value string) string {
+	if rest := TracestateDelete(ts, key); rest != "" {
+		return key + "=" + value + "," + rest
+	}
+	return key + "=" + value
+}
+
+// TracestateDelete removes the key from a w3c tracestate.
+func TracestateDelete(ts string, key string) string {
+	members := []string{}
+	for _, member := range strings.Split(ts, ",") {
+		member = strings.TrimSpace(member)
+		if k, _, _ := strings.Cut(member, "="); member != "" && k != key {
+			members = append(members, member)
+		}
+	}
+	return strings.Join(members, ",")
+}
+
+// isForceKept reports whether the tracestate marks the trace to be kept.
+func isForceKept(ts string) bool {
+	v, ok := TracestateGet(ts, KeepTracestateKey)
+	return ok && v == "1"
+}
+
+// tracestateHops returns the value of the hop counter in the tracestate, or
+// zero if it is missing or invalid.
+func tracestateHops(ts string) int {
+	v, ok := TracestateGet(ts, HopsTracestateKey)
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// tracestateRate returns the sampling rate stored in the tracestate under the
+// key. If field is set, the value of the key is a list of field:value pairs
+// separated by semicolons, like in the tracestate of Datadog, and the rate is
+// the value of the field.
+func tracestateRate(ts string, key string, field string) (float64, bool) {
+	v, ok := TracestateGet(ts, key)
+	if !ok {
+		return 0, false
+	}
+	if field != "" {
+		ok = false
+		for _, pair := range strings.Split(v, ";") {
+			if f, fv, found := strings.Cut(pair, ":"); found && f == field {
+				v, ok = fv, true
+				break
+			}
+		}
+		if !ok {
+			return 0, false
+		}
+	}
+	rate, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, false
+	}
+	return rate, true
+}
+
+// ValidateTracestateKey checks that the key of a tracestate member follows the
+// rules of the w3c specification. A key is either a simple key of up to 256
+// characters that starts with a lower case letter, or a multi-tenant key of a
+// tenant id of up to 241 characters that starts with a lower case letter or a
+// digit, and a system id of up to 14 characters that starts with a lower case
+// letter, joined by "@". The other characters are lower case letters, digits
+// or any of "_-*/".
+func ValidateTracestateKey(key string) error {
+	tenant, system, multi := strings.Cut(key, "@")
+	if !multi {
+		if !validKeyPart(key, 256, false) {
+			return fmt.Errorf("invalid tracestate key")
+		}
+		return nil
+	}
+	if !validKeyPart(tenant, 241, true) || !validKeyPart(system, 14, false) {
+		return fmt.Errorf("invalid tracestate key")
+	}
+	return nil
+}
+
+// validKeyPart checks a part of a tracestate key with a maximum length. The
+// first character must be a lower case letter, or also a digit if digit is
+// set.
+func validKeyPart(part string, max int, digit bool) bool {
+	if part == "" || len(part) > max {
+		return false
+	}
+	if c := part[0]; (c < 'a' || c > 'z') && (!digit || c < '0' || c > '9') {
+		return false
+	}
+	for i := 1; i < len(part); i++ {
+		c := part[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '_', c == '-', c == '*', c == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateTracestateValue checks that the value of a tracestate member
+// follows the rules of the w3c specification. A value has 1 to 256 printable
+// ascii characters other than "," and "=", and it does not end with a space.
+func ValidateTracestateValue(value string) error {
+	if value == "" || len(value) > 256 || value[len(value)-1] == ' ' {
+		return fmt.Errorf("invalid tracestate value")
+	}
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c < 0x20 || c > 0x7e || c == ',' || c == '=' {
+			return fmt.Errorf("invalid tracestate value")
+		}
+	}
+	return nil
+}
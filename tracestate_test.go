@@ -0,0 +1,30 @@
+package trace
+
+import "testing"
+
+func TestTracestateKeysAreValid(t *testing.T) {
+	for _, key := range []string{KeepTracestateKey, HopsTracestateKey} {
+		if err := ValidateTracestateKey(key); err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+}
+
+func TestTracestateKeysDoNotCollide(t *testing.T) {
+	ts := "keep=1,hops=99"
+	if isForceKept(ts) {
+		t.Error("a member of another vendor force-kept the trace")
+	}
+	if n := tracestateHops(ts); n != 0 {
+		t.Errorf("got %d hops from a member of another vendor", n)
+	}
+
+	ts = TracestateSet(ts, KeepTracestateKey, "1")
+	ts = TracestateSet(ts, HopsTracestateKey, "2")
+	if !isForceKept(ts) || tracestateHops(ts) != 2 {
+		t.Errorf("got tracestate %q", ts)
+	}
+	if v, _ := TracestateGet(ts, "hops"); v != "99" {
+		t.Errorf("member of another vendor changed to %q", v)
+	}
+}
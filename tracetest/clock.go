@@ -0,0 +1,101 @@
+// Package tracetest provides utilities for testing code that uses traces.
+package tracetest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Soreing/trace"
+)
+
+// ManualClock is a trace.Clock whose time only changes when it is advanced,
+// which makes tests of batching deterministic without real sleeps. Timers
+// fire when the clock is advanced to or past their deadline.
+type ManualClock struct {
+	mtx    *sync.Mutex
+	now    time.Time
+	timers map[*manualTimer]struct{}
+}
+
+// NewManualClock creates a manual clock that starts at the given time.
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{
+		mtx:    &sync.Mutex{},
+		now:    start,
+		timers: map[*manualTimer]struct{}{},
+	}
+}
+
+// Now returns the current time of the clock.
+func (c *ManualClock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+// NewTimer creates a timer that fires when the clock is advanced by d.
+func (c *ManualClock) NewTimer(d time.Duration) trace.Timer {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	t := &manualTimer{
+		clock:    c,
+		ch:       make(chan time.Time, 1),
+		deadline: c.now.Add(d),
+	}
+	c.timers[t] = struct{}{}
+	c.fire()
+	return t
+}
+
+// Advance moves the time of the clock forward by d and fires the timers whose
+// deadline has passed.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.now = c.now.Add(d)
+	c.fire()
+}
+
+// fire sends the current time on the channels of the expired active timers.
+func (c *ManualClock) fire() {
+	for t := range c.timers {
+		if !t.deadline.After(c.now) {
+			delete(c.timers, t)
+			select {
+			case t.ch <- c.now:
+			default:
+			}
+		}
+	}
+}
+
+// manualTimer is a timer of a manual clock. It is active while it is in the
+// timers of the clock.
+type manualTimer struct {
+	clock    *ManualClock
+	ch       chan time.Time
+	deadline time.Time
+}
+
+func (t *manualTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *manualTimer) Stop() bool {
+	t.clock.mtx.Lock()
+	defer t.clock.mtx.Unlock()
+	_, active := t.clock.timers[t]
+	delete(t.clock.timers, t)
+	return active
+}
+
+func (t *manualTimer) Reset(d time.Duration) bool {
+	t.clock.mtx.Lock()
+	defer t.clock.mtx.Unlock()
+	_, active := t.clock.timers[t]
+	t.clock.timers[t] = struct{}{}
+	t.deadline = t.clock.now.Add(d)
+	t.clock.fire()
+	return active
+}
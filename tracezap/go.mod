@@ -0,0 +1,21 @@
+module github.com/Soreing/trace/tracezap
+
+go 1.20
+
+require (
+	github.com/Soreing/trace v0.2.0
+	go.uber.org/zap v1.26.0
+)
+
+require (
+	github.com/Soreing/grand v0.1.0 // indirect
+	github.com/Soreing/motel v0.1.2 // indirect
+	github.com/go-logr/logr v1.2.4 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/otel v1.19.0 // indirect
+	go.opentelemetry.io/otel/metric v1.19.0 // indirect
+	go.opentelemetry.io/otel/sdk v1.19.0 // indirect
+	go.opentelemetry.io/otel/trace v1.19.0 // indirect
+	go.uber.org/multierr v1.10.0 // indirect
+	golang.org/x/sys v0.12.0 // indirect
+)
@@ -0,0 +1,40 @@
+// Package tracezap adds the trace context stored in contexts to zap logs.
+package tracezap
+
+import (
+	"context"
+
+	"github.com/Soreing/trace"
+	"go.uber.org/zap"
+)
+
+// Field keys of the trace context.
+const (
+	TraceIdKey = trace.LogTraceIdKey
+	SpanIdKey  = trace.LogSpanIdKey
+)
+
+// Fields returns zap fields with the trace id and span id of the trace info
+// stored in the context. It returns no fields if the context has none.
+func Fields(ctx context.Context) []zap.Field {
+	inf, _ := trace.TraceInfoFromContext(ctx)
+	if inf == nil {
+		return nil
+	}
+	tid, _, sid := inf.GetStringIds()
+	return []zap.Field{
+		zap.String(TraceIdKey, tid),
+		zap.String(SpanIdKey, sid),
+	}
+}
+
+// Logger returns a child of the logger with the trace id and span id of the
+// trace info stored in the context. It returns the logger itself if the
+// context has none.
+func Logger(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	fields := Fields(ctx)
+	if len(fields) == 0 {
+		return logger
+	}
+	return logger.With(fields...)
+}
@@ -0,0 +1,72 @@
+package trace
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// UTF8Mode defines how invalid UTF-8 in span names and string attributes is
+// handled when spans are built.
+type UTF8Mode uint8
+
+const (
+	// UTF8Unchecked leaves names and attributes as they are.
+	UTF8Unchecked UTF8Mode = iota
+	// UTF8Replace replaces invalid byte sequences with U+FFFD.
+	UTF8Replace
+	// UTF8Drop drops attributes with invalid strings and rejects spans with
+	// invalid names.
+	UTF8Drop
+)
+
+// sanitizeName validates the span name according to the mode.
+func sanitizeName(name string, mode UTF8Mode) (string, error) {
+	if mode == UTF8Unchecked || utf8.ValidString(name) {
+		return name, nil
+	}
+	if mode == UTF8Drop {
+		return "", fmt.Errorf("invalid span name")
+	}
+	return strings.ToValidUTF8(name, "\uFFFD"), nil
+}
+
+// sanitizeAttribute validates the string values of the attribute according
+// to the mode. It reports false if the attribute should be dropped.
+func sanitizeAttribute(
+	kv attribute.KeyValue,
+	mode UTF8Mode,
+) (attribute.KeyValue, bool) {
+	if mode == UTF8Unchecked {
+		return kv, true
+	}
+
+	switch kv.Value.Type() {
+	case attribute.STRING:
+		val := kv.Value.AsString()
+		if utf8.ValidString(val) {
+			return kv, true
+		} else if mode == UTF8Drop {
+			return kv, false
+		}
+		return kv.Key.String(strings.ToValidUTF8(val, "\uFFFD")), true
+	case attribute.STRINGSLICE:
+		vals := kv.Value.AsStringSlice()
+		valid := true
+		for i := range vals {
+			if !utf8.ValidString(vals[i]) {
+				if mode == UTF8Drop {
+					return kv, false
+				}
+				vals[i] = strings.ToValidUTF8(vals[i], "\uFFFD")
+				valid = false
+			}
+		}
+		if !valid {
+			return kv.Key.StringSlice(vals), true
+		}
+	}
+	return kv, true
+}